@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	afadURL        = "https://deprem.afad.gov.tr/apiv2/event/filter"
+	afadTimeLayout = "2006-01-02T15:04:05"
+	// afadWindow is how far back the AFAD events are queried, roughly the span
+	// of the KOERI list.
+	afadWindow = 3 * 24 * time.Hour
+)
+
+// AFADSource queries the event API of AFAD, the Turkish disaster agency.
+type AFADSource struct {
+	URL string
+}
+
+// afadEvent is an event in the AFAD API response. The API encodes numbers as
+// strings, json.Number accepts both.
+type afadEvent struct {
+	Location  string      `json:"location"`
+	Province  string      `json:"province"`
+	District  string      `json:"district"`
+	Latitude  json.Number `json:"latitude"`
+	Longitude json.Number `json:"longitude"`
+	Depth     json.Number `json:"depth"`
+	Magnitude json.Number `json:"magnitude"`
+	Date      string      `json:"date"`
+}
+
+func (s AFADSource) GetEarthquakes(ctx context.Context, cfg Config) ([]Earthquake, error) {
+	end := time.Now().UTC()
+	query := url.Values{
+		"start":   {end.Add(-afadWindow).Format(afadTimeLayout)},
+		"end":     {end.Format(afadTimeLayout)},
+		"orderby": {"timedesc"},
+		"format":  {"json"},
+	}
+	if !cfg.All {
+		query.Set("minmag", strconv.FormatFloat(float64(lowestMinMagnitude(cfg)), 'f', 1, 32))
+	}
+	reqURL := s.URL + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating afad request, url=%s: %w", reqURL, err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"error while getting earthquakes from afad, url=%s: %w: %w",
+			reqURL,
+			ErrObservatoryUnreachable,
+			err,
+		)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &httpStatusError{Server: "afad", URL: reqURL, StatusCode: resp.StatusCode}
+	}
+	var events []afadEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("error while decoding afad response, url=%s: %w: %w", reqURL, ErrFormatChanged, err)
+	}
+	eqs := make([]Earthquake, 0, len(events))
+	for _, event := range events {
+		eq, err := parseAFADEvent(event)
+		if err != nil {
+			if !cfg.QuietErrors {
+				fmt.Fprintf(os.Stderr, "error while parsing afad event event=%+v: %s\n", event, err)
+			}
+			continue
+		}
+		eqs = append(eqs, eq)
+	}
+	if len(eqs) == 0 && len(events) > 0 {
+		return nil, fmt.Errorf("%w, skipped %d events", ErrFormatChanged, len(events))
+	}
+	return eqs, nil
+}
+
+func parseAFADEvent(event afadEvent) (Earthquake, error) {
+	datetime, err := time.ParseInLocation(afadTimeLayout, event.Date, time.UTC)
+	if err != nil {
+		return Earthquake{}, fmt.Errorf("error while parsing date of the earthquake date=%s: %w", event.Date, err)
+	}
+	lat, err := event.Latitude.Float64()
+	if err != nil {
+		return Earthquake{}, fmt.Errorf("error while parsing latitude of the earthquake: %w", err)
+	}
+	long, err := event.Longitude.Float64()
+	if err != nil {
+		return Earthquake{}, fmt.Errorf("error while parsing longitude of the earthquake: %w", err)
+	}
+	depth, err := event.Depth.Float64()
+	if err != nil {
+		return Earthquake{}, fmt.Errorf("error while parsing depth of the earthquake: %w", err)
+	}
+	mag, err := event.Magnitude.Float64()
+	if err != nil {
+		return Earthquake{}, fmt.Errorf("error while parsing magnitude of the earthquake: %w", err)
+	}
+	// Match the "PROVINCE EPICENTER" shape of the KOERI locations, events at
+	// sea have no province and only carry the free form location.
+	location := event.Location
+	if event.Province != "" {
+		location = fmt.Sprintf("%s %s", event.Province, event.District)
+	}
+	return Earthquake{
+		Location:  foldTurkish(location),
+		Province:  foldTurkish(event.Province),
+		Latitude:  lat,
+		Longitude: long,
+		Time:      datetime.Local(),
+		Magnitude: float32(mag),
+		Depth:     float32(depth),
+
+		coordDecimals: coordDecimals(event.Latitude.String(), event.Longitude.String()),
+	}, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAFADSourceGetEarthquakes(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		http.ServeFile(w, r, "testdata/afad.json")
+	}))
+	defer srv.Close()
+	eqs, err := AFADSource{URL: srv.URL}.GetEarthquakes(context.Background(), Config{MinMagnitude: 4.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "minmag=4.5"; !strings.Contains(query, want) {
+		t.Errorf("query = %q, want it to contain %q", query, want)
+	}
+	want := []Earthquake{
+		{
+			Location:  "KAHRAMANMARAS PAZARCIK",
+			Province:  "KAHRAMANMARAS",
+			Latitude:  37.288,
+			Longitude: 37.043,
+			Time:      time.Date(2023, 2, 6, 1, 17, 34, 0, time.UTC),
+			Magnitude: 7.7,
+			Depth:     8.6,
+		},
+		{
+			Location:  "EGE DENIZI",
+			Latitude:  38.61,
+			Longitude: 26.14,
+			Time:      time.Date(2023, 2, 5, 22, 3, 12, 0, time.UTC),
+			Magnitude: 4.6,
+			Depth:     10.4,
+		},
+	}
+	if len(eqs) != len(want) {
+		t.Fatalf("GetEarthquakes() returned %d earthquakes, want %d", len(eqs), len(want))
+	}
+	for i, eq := range eqs {
+		w := want[i]
+		if eq.Location != w.Location || eq.Province != w.Province || eq.Latitude != w.Latitude ||
+			eq.Longitude != w.Longitude || eq.Magnitude != w.Magnitude || eq.Depth != w.Depth {
+			t.Errorf("earthquake %d = %+v, want %+v", i, eq, w)
+		}
+		// AFAD dates are UTC, they are shown in the local time zone.
+		if !eq.Time.Equal(w.Time) {
+			t.Errorf("earthquake %d time = %s, want %s", i, eq.Time, w.Time)
+		}
+	}
+	if got := eqs[1].Region(); got != "EGE DENIZI" {
+		t.Errorf("Region() of an earthquake at sea = %q, want the location", got)
+	}
+}
+
+func TestParseAFADEventInvalidDate(t *testing.T) {
+	event := afadEvent{Latitude: "37", Longitude: "37", Depth: "7", Magnitude: "4", Date: "06.02.2023 01:17:34"}
+	if _, err := parseAFADEvent(event); err == nil {
+		t.Error("parseAFADEvent() error = nil, want an error for a date in another layout")
+	}
+}
@@ -1,45 +1,367 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 const (
 	observatoryURL                = "http://www.koeri.boun.edu.tr/scripts/lst4.asp"
 	defaultMaxDepth       float32 = 70
 	defaultMinMagnitude           = 4.5
-	earthquakeLinePattern         = `(\d{4}\.\d{2}\.\d{2})\s(\d{2}:\d{2}:\d{2})\s+(\d+\.\d+)\s+(\d+\.\d+)\s+(\d+\.\d+)\s+[^\s]+\s+(\d+\.\d+)\s+[^\s]+\s+(\w+-(\w+)?) ?\(\w+\)`
+	depthUnitKm                   = "km"
+	depthUnitM                    = "m"
+	earthquakeLinePattern         = `(\d{4}\.\d{2}\.\d{2})\s(\d{2}:\d{2}:\d{2})\s+(\d+\.\d+)\s+(\d+\.\d+)\s+(\d+\.\d+)\s+[^\s]+\s+(\d+\.\d+)\s+[^\s]+\s+([\p{L}\p{N}_]+-([\p{L}\p{N}_]+)?) ?\(([\p{L}\p{N}_]+)\)`
+)
+
+// defaultStalenessThreshold is the age of the newest earthquake after which the
+// data is assumed to be stale.
+const defaultStalenessThreshold = 6 * time.Hour
+
+const (
+	sortTime                     = "time"
+	sortMagnitude                = "magnitude"
+	sortRecencyWeightedMagnitude = "recency-weighted-magnitude"
+	defaultSortDecay             = 12 * time.Hour
 )
 
 var eqLineRegex = regexp.MustCompile(earthquakeLinePattern)
 
+// httpClient is used for every request, main sets it up from the config.
+var httpClient = http.DefaultClient
+
+// timeNow returns the time the ages of the earthquakes are shown relative to.
+var timeNow = time.Now
+
+// kandilli is the location of the observatory, used as the reference point of
+// the coordinate debug output. Every KOERI event should be within a couple of
+// thousand kilometers of it.
+var kandilli = LatLon{Latitude: 41.0636, Longitude: 29.0614}
+
 type Config struct {
-	All          bool
-	MaxDepth     float32
-	MinMagnitude float32
+	All                  bool
+	MaxDepth             float32
+	MinMagnitude         float32
+	Deadline             time.Duration
+	Format               string
+	Fault                string
+	DepthUnit            string
+	QuietErrors          bool
+	RegexFlags           string
+	DebugCoords          bool
+	Lang                 string
+	Source               string
+	Staleness            time.Duration
+	BestEffort           bool
+	MagBars              bool
+	FailOnEmpty          bool
+	NoTrailingNewline    bool
+	Outputs              []Destination
+	MagnitudeRound       string
+	BothTimes            bool
+	Percentile           float64
+	Strict               bool
+	PipeTo               string
+	CountOnly            bool
+	Label                string
+	Nagios               bool
+	WarningCount         int
+	CriticalCount        int
+	SummaryJSON          bool
+	Regions              []string
+	ExcludeRegions       []string
+	Stdin                bool
+	CheckUpdate          bool
+	MapLinks             bool
+	Hyperlinks           bool
+	Head                 int
+	Tail                 int
+	Sort                 string
+	SortDecay            time.Duration
+	Sanity               bool
+	Accessible           bool
+	Trace                bool
+	Headers              map[string]string
+	ColorDepth           bool
+	ParseLine            string
+	Footer               bool
+	UnknownDepthPolicy   string
+	MagnitudeBar         bool
+	Matrix               []DepthBand
+	ShowDepthStars       bool
+	Reverse              bool
+	UniqueBy             string
+	JSONNumbersAsStrings bool
+	TopProvinces         int
+	Sample               int
+	Seed                 int64
+	NoHeader             bool
+	CoordPrecision       int
+	Emoji                bool
+	Number               bool
+	MinCoordPrecision    int
+	Insecure             bool
+
+	// elidedAt is the index of the first earthquake after the ones left out
+	// by Head and Tail, 0 when none are left out. It is set after fetching.
+	elidedAt int
+	// fetchedAt is when the earthquakes were fetched.
+	fetchedAt time.Time
 }
 
 type Earthquake struct {
-	Location  string
-	Latitude  float64
-	Longitude float64
-	Time      time.Time
-	Magnitude float32
-	Depth     float32
+	Location  string    `json:"location"`
+	Province  string    `json:"province"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Time      time.Time `json:"time"`
+	Magnitude float32   `json:"magnitude"`
+	Depth     float32   `json:"depth"`
+
+	// coordDecimals is the fewest decimal places the source reported the
+	// coordinates with, a proxy of how precisely the earthquake was located.
+	coordDecimals int
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "selftest":
+			os.Exit(selftest())
+		case "update-check":
+			os.Exit(updateCheck())
+		}
+	}
 	cfg := newConfig()
-	earthquakes := getEarthquakes(cfg)
-	printEarthquakes(earthquakes)
+	if cfg.RegexFlags != "" {
+		eqLineRegex = regexp.MustCompile("(?" + cfg.RegexFlags + ")" + earthquakeLinePattern)
+	}
+	if cfg.ParseLine != "" {
+		os.Exit(printParsedLine(os.Stdout, cfg, cfg.ParseLine))
+	}
+	httpClient = newHTTPClient(cfg)
+	ctx := context.Background()
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+		defer cancel()
+	}
+	cfg.fetchedAt = time.Now()
+	earthquakes, err := getEarthquakes(ctx, cfg)
+	if cfg.Nagios {
+		os.Exit(printNagios(os.Stdout, cfg, earthquakes, err))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error while getting earthquakes: %s\n", err)
+		os.Exit(exitCode(err))
+	}
+	for i := range earthquakes {
+		earthquakes[i].Location = translateLocation(cfg.Lang, earthquakes[i].Location)
+	}
+	sortEarthquakes(cfg, cfg.fetchedAt, earthquakes)
+	earthquakes, cfg.elidedAt = headTail(cfg, earthquakes)
+	if err := writeOutputs(ctx, cfg, earthquakes); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUnknown)
+	}
+	if cfg.PipeTo != "" {
+		err := pipeTo(cfg.PipeTo, render(withoutDecorations(cfg), cfg.Format, earthquakes))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUnknown)
+		}
+	}
+	if cfg.CheckUpdate && os.Getenv("DPRM_NO_UPDATE_CHECK") != "1" {
+		// The output is already written, a slow GitHub must not hold dprm.
+		checkCtx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+		latest, err := getLatestRelease(checkCtx, releasesURL)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not check for updates: %s\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, updateMessage(latest))
+		}
+	}
+	if cfg.FailOnEmpty && len(earthquakes) == 0 {
+		os.Exit(exitCode(ErrNoEarthquakesFound))
+	}
+}
+
+// Nagios plugin statuses, used as exit codes with -nagios.
+const (
+	nagiosOK = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+const (
+	defaultWarningCount  = 5
+	defaultCriticalCount = 10
+)
+
+// printNagios prints the status line of a Nagios plugin with the earthquake
+// count as performance data and returns the plugin status. Like the Nagios
+// thresholds, a status is reached when the count is above its threshold.
+func printNagios(w io.Writer, cfg Config, eqs []Earthquake, err error) int {
+	if err != nil {
+		fmt.Fprintf(w, "UNKNOWN: %s\n", err)
+		return nagiosUnknown
+	}
+	status, label := nagiosOK, "OK"
+	if len(eqs) > cfg.CriticalCount {
+		status, label = nagiosCritical, "CRITICAL"
+	} else if len(eqs) > cfg.WarningCount {
+		status, label = nagiosWarning, "WARNING"
+	}
+	fmt.Fprintf(
+		w,
+		"%s: %d significant earthquakes | count=%d;%d;%d\n",
+		label,
+		len(eqs),
+		len(eqs),
+		cfg.WarningCount,
+		cfg.CriticalCount,
+	)
+	return status
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// stringsFlag is a flag that can be given multiple times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Exit codes of dprm, documented in the usage.
+const (
+	exitOK = iota
+	exitUnknown
+	exitNetwork
+	exitServer
+	exitParse
+	exitEmpty
+	exitUsage
+)
+
+const exitCodesUsage = `
+Exit codes:
+  0	success
+  1	unknown error
+  2	network unreachable
+  3	server error (HTTP 4xx/5xx)
+  4	parse error
+  5	no earthquakes to show with -fail-on-empty
+  6	invalid flags
+`
+
+func usage() {
+	fmt.Fprintln(flag.CommandLine.Output(), "Usage:")
+	fmt.Fprintf(flag.CommandLine.Output(), "  %s [flags]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "  %s selftest\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "  %s update-check\n\n", os.Args[0])
+	printVisibleDefaults(flag.CommandLine)
+	fmt.Fprint(flag.CommandLine.Output(), exitCodesUsage)
+}
+
+// hiddenFlags are left out of the usage, they are meant for debugging dprm.
+var hiddenFlags = map[string]bool{"debug-coords": true}
+
+// printVisibleDefaults prints the defaults of the flags like PrintDefaults,
+// leaving out the hidden flags.
+func printVisibleDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// Errors wrapped by the errors of dprm, to be checked with errors.Is.
+var (
+	// ErrObservatoryUnreachable is returned when the request to a source
+	// fails before getting a response.
+	ErrObservatoryUnreachable = errors.New("observatory unreachable")
+	// ErrNoEarthquakesFound is returned when there are no earthquakes to show
+	// and there should be.
+	ErrNoEarthquakesFound = errors.New("no earthquakes found")
+	// ErrFormatChanged is returned when a source responds but none of its
+	// earthquakes can be parsed.
+	ErrFormatChanged = errors.New("observatory format changed")
+)
+
+// errUnexpectedPage is returned when a source responds successfully with
+// something that is not an earthquake list, like an error page.
+var errUnexpectedPage = errors.New("unexpected page without earthquakes")
+
+// httpStatusError is returned when a source responds with an error status.
+type httpStatusError struct {
+	Server     string
+	URL        string
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %d, url=%s", e.Server, e.StatusCode, e.URL)
+}
+
+func exitCode(err error) int {
+	var statusErr *httpStatusError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &statusErr), errors.Is(err, errUnexpectedPage):
+		return exitServer
+	case errors.Is(err, ErrFormatChanged):
+		return exitParse
+	case errors.Is(err, ErrNoEarthquakesFound):
+		return exitEmpty
+	case errors.Is(err, ErrObservatoryUnreachable), errors.As(err, &netErr):
+		return exitNetwork
+	default:
+		return exitUnknown
+	}
 }
 
 func newConfig() Config {
@@ -54,139 +376,1447 @@ func newConfig() Config {
 		float64(defaultMinMagnitude),
 		"min magnitude of an important earthquake",
 	)
-	flag.Parse()
+	deadline := flag.Duration(
+		"deadline",
+		0,
+		"time budget for the whole run, partial results are shown when exceeded (0 means no limit)",
+	)
+	tsv := flag.Bool("tsv", false, "print tab-separated values with a header row, same as -format tsv")
+	rss := flag.Bool("rss", false, "print an RSS feed with an item per earthquake, same as -format rss")
+	formatFlag := flag.String(
+		"format",
+		formatText,
+		"output format (text, tsv, jsonl, region-jsonl or rss)",
+	)
+	fault := flag.String("fault", "", "only show earthquakes near a fault line (NAF or EAF)")
+	depthUnit := flag.String("depth-unit", depthUnitKm, "unit of the depth in every output, JSON included (km or m)")
+	quietErrors := flag.Bool(
+		"quiet-errors",
+		false,
+		"do not print per-line parse errors, only the number of skipped lines",
+	)
+	regexFlags := flag.String(
+		"regex-flags",
+		"",
+		"RE2 flags applied to the earthquake line pattern, any of i, m and s (e.g. is)",
+	)
+	debugCoords := flag.Bool(
+		"debug-coords",
+		false,
+		"print parsed coordinates and distance to the observatory to stderr",
+	)
+	lang := flag.String("lang", langTR, "language of the location names (tr or en)")
+	source := flag.String("source", "koeri", "where to get the earthquakes from (koeri or afad)")
+	staleness := flag.Duration(
+		"staleness-threshold",
+		defaultStalenessThreshold,
+		"warn when the newest earthquake is older than this, not checked for -source afad without -a as it filters by magnitude (0 disables the warning)",
+	)
+	bestEffort := flag.Bool(
+		"best-effort",
+		false,
+		"report fetch errors and continue with no earthquakes instead of exiting with failure",
+	)
+	magBars := flag.Bool("mag-bars", false, "show a bar proportional to the magnitude in the table")
+	sortKey := flag.String(
+		"sort",
+		sortTime,
+		"order of the earthquakes (time, magnitude or recency-weighted-magnitude)",
+	)
+	sortDecay := flag.Duration(
+		"sort-decay",
+		defaultSortDecay,
+		"age that costs one magnitude unit in recency-weighted-magnitude sorting",
+	)
+	failOnEmpty := flag.Bool(
+		"fail-on-empty",
+		false,
+		fmt.Sprintf("exit with %d when there are no earthquakes to show", exitEmpty),
+	)
+	noTrailingNewline := flag.Bool(
+		"no-trailing-newline",
+		false,
+		"do not end the output with a newline",
+	)
+	var outputs stringsFlag
+	flag.Var(
+		&outputs,
+		"output",
+		"where to write the output, - or stdout, stderr, null, a file or tcp://host:port, "+
+			"optionally followed by :format (can be repeated)",
+	)
+	magnitudeRound := flag.String(
+		"magnitude-round",
+		magnitudeRoundNearest,
+		"how the rounded magnitudes are compared to -m: nearest compares them as reported, "+
+			"up and down compare them as the largest and smallest values rounding to them",
+	)
+	bothTimes := flag.Bool(
+		"both-times",
+		false,
+		"show how long ago the earthquake was next to its time in the table",
+	)
+	percentileFlag := flag.Float64(
+		"percentile",
+		0,
+		"only show earthquakes at or above this percentile of the fetched magnitudes, "+
+			"on top of the other filters (0 disables it)",
+	)
+	tee := flag.String(
+		"tee",
+		"",
+		"write the output to this file as well as stdout, in addition to any -output",
+	)
+	strict := flag.Bool(
+		"strict",
+		false,
+		"treat an observatory page without any earthquake lines and lines with shifted columns as errors",
+	)
+	pipeTo := flag.String(
+		"pipe-to",
+		"",
+		"run this shell command with the output as its stdin and exit with its exit code",
+	)
+	countOnly := flag.Bool("count-only", false, "only print the number of earthquakes")
+	label := flag.String("label", "", "text printed before the number with -count-only")
+	nagios := flag.Bool(
+		"nagios",
+		false,
+		"print a Nagios plugin status line and exit with the matching status",
+	)
+	warningCount := flag.Int(
+		"warning-count",
+		defaultWarningCount,
+		"number of earthquakes above which -nagios reports WARNING",
+	)
+	criticalCount := flag.Int(
+		"critical-count",
+		defaultCriticalCount,
+		"number of earthquakes above which -nagios reports CRITICAL",
+	)
+	summaryJSON := flag.Bool(
+		"summary-json",
+		false,
+		"only print a JSON digest of the earthquakes instead of listing them",
+	)
+	regions := flag.String(
+		"region",
+		"",
+		"only show earthquakes in these comma separated places, e.g. IZMIR,MANISA",
+	)
+	excludeRegions := flag.String(
+		"exclude-region",
+		"",
+		"hide earthquakes in these comma separated places, applied after -region",
+	)
+	stdin := flag.Bool("stdin", false, "read the observatory page from stdin instead of fetching it")
+	checkUpdate := flag.Bool(
+		"check-update",
+		false,
+		"tell on stderr when a newer release is available, within -deadline",
+	)
+	mapLinks := flag.Bool("map-links", false, "show an OpenStreetMap link of every earthquake in the table")
+	hyperlinks := flag.Bool(
+		"hyperlinks",
+		false,
+		"print -map-links as OSC 8 terminal hyperlinks",
+	)
+	head := flag.Int("head", 0, "only show the first n earthquakes")
+	tail := flag.Int("tail", 0, "only show the last n earthquakes, after -head ones when both are given")
+	sanity := flag.Bool(
+		"sanity",
+		false,
+		"warn about KOERI earthquakes outside of Turkey, which are likely parse errors",
+	)
+	accessible := flag.Bool(
+		"accessible",
+		false,
+		"describe every earthquake in a sentence instead of a table, for screen readers",
+	)
+	trace := flag.Bool(
+		"trace",
+		false,
+		"print HTTP requests and responses, with the start of response bodies and connection timings, to stderr",
+	)
+	var headerValues stringsFlag
+	flag.Var(&headerValues, "header", "extra Name:Value header of the HTTP requests (can be repeated)")
+	colorDepth := flag.Bool(
+		"color-depth",
+		false,
+		"color depths from red for shallow to blue for deep, in outputs to a terminal when NO_COLOR is unset",
+	)
+	parseLineFlag := flag.String(
+		"parse-line",
+		"",
+		"parse a single observatory `line`, or one read from stdin with -, print it as JSON and exit without fetching",
+	)
+	footer := flag.Bool(
+		"footer",
+		false,
+		"end the text output with the fetch time and the time of the newest earthquake",
+	)
+	unknownDepthPolicy := flag.String(
+		"unknown-depth-policy",
+		unknownDepthShallow,
+		"how a depth of 0.0, which often means undetermined, is compared to -d: "+
+			"shallow compares it as it is, deep as deeper than any limit and exclude leaves it out",
+	)
+	magnitudeBarFlag := flag.Bool(
+		"magnitude-bar",
+		false,
+		"end every table row with a single block character whose height shows the magnitude",
+	)
+	matrixFlag := flag.String(
+		"matrix",
+		"",
+		"comma separated depth:magnitude bands, like 30:3.5,70:4.5,inf:5, showing earthquakes shallower "+
+			"than a band's depth and above its magnitude, or @file to read them from a file. "+
+			"Takes precedence over -m and -d",
+	)
+	showDepthStars := flag.Bool(
+		"show-depth-stars",
+		false,
+		"show one to five stars next to the depth in the table, more for shallower and so more hazardous earthquakes",
+	)
+	reverse := flag.Bool("reverse", false, "reverse the order of -sort, showing the oldest earthquakes first by default")
+	reverseShort := flag.Bool("r", false, "same as -reverse")
+	uniqueLocations := flag.Bool(
+		"unique-locations",
+		false,
+		"keep one earthquake per province or sea, chosen by -unique-by",
+	)
+	uniqueByFlag := flag.String(
+		"unique-by",
+		uniqueByTime,
+		"which earthquake -unique-locations keeps per province (time for the most recent or magnitude for the largest)",
+	)
+	jsonNumbersAsStrings := flag.Bool(
+		"json-numbers-as-strings",
+		false,
+		"write magnitudes, depths and coordinates in JSON as fixed precision strings",
+	)
+	topProvinces := flag.Int(
+		"top-provinces",
+		0,
+		"only show the earthquakes of the n provinces or seas with the most earthquakes after filtering (0 shows all)",
+	)
+	sample := flag.Int(
+		"sample",
+		0,
+		"only show n randomly chosen earthquakes after filtering (0 shows all)",
+	)
+	seedFlag := flag.Int64("seed", 0, "seed of -sample, for the same sample on every run (0 picks a random seed)")
+	noHeader := flag.Bool("no-header", false, "leave out the header row of the tsv format, for appending to files")
+	coordPrecision := flag.Int(
+		"coord-precision",
+		4,
+		"decimal places of the coordinates in JSON outputs, as reported by the observatory by default",
+	)
+	emoji := flag.Bool(
+		"emoji",
+		false,
+		"start every table row with a colored circle for the magnitude, in outputs to a terminal",
+	)
+	number := flag.Bool("number", false, "start every table row with its 1-based position, to refer to earthquakes by it")
+	numberShort := flag.Bool("n", false, "same as -number")
+	minCoordPrecision := flag.Int(
+		"min-coord-precision",
+		0,
+		"only show earthquakes whose coordinates were reported with at least this many decimal places, "+
+			"as rough automatic locations are reported with fewer (0 shows all)",
+	)
+	insecure := flag.Bool(
+		"insecure",
+		false,
+		"do not verify the TLS certificates of the sources, only to get data while their certificates are broken",
+	)
+	flag.Usage = usage
+	// Invalid flags exit with exitUsage rather than the 2 of the flag package,
+	// which is exitNetwork.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(exitOK)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
+	if _, ok := faults[*fault]; *fault != "" && !ok {
+		fmt.Fprintf(os.Stderr, "unknown fault %q, expected NAF or EAF\n", *fault)
+		os.Exit(exitUsage)
+	}
+	if strings.Trim(*regexFlags, "ims") != "" {
+		fmt.Fprintf(os.Stderr, "invalid regex flags %q, expected any of i, m and s\n", *regexFlags)
+		os.Exit(exitUsage)
+	}
+	if _, ok := sources[*source]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown source %q, expected koeri or afad\n", *source)
+		os.Exit(exitUsage)
+	}
+	if *stdin && *source != "koeri" {
+		fmt.Fprintln(os.Stderr, "-stdin only reads KOERI observatory pages")
+		os.Exit(exitUsage)
+	}
+	if *percentileFlag < 0 || *percentileFlag > 100 {
+		fmt.Fprintf(os.Stderr, "percentile must be between 0 and 100, got %g\n", *percentileFlag)
+		os.Exit(exitUsage)
+	}
+	switch *magnitudeRound {
+	case magnitudeRoundNearest, magnitudeRoundUp, magnitudeRoundDown:
+	default:
+		fmt.Fprintf(
+			os.Stderr,
+			"unknown magnitude rounding %q, expected nearest, up or down\n",
+			*magnitudeRound,
+		)
+		os.Exit(exitUsage)
+	}
+	switch *sortKey {
+	case sortTime, sortMagnitude, sortRecencyWeightedMagnitude:
+	default:
+		fmt.Fprintf(
+			os.Stderr,
+			"unknown sort %q, expected time, magnitude or recency-weighted-magnitude\n",
+			*sortKey,
+		)
+		os.Exit(exitUsage)
+	}
+	if *sortDecay <= 0 {
+		fmt.Fprintf(os.Stderr, "sort decay must be positive, got %s\n", *sortDecay)
+		os.Exit(exitUsage)
+	}
+	if *lang != langTR && *lang != langEN {
+		fmt.Fprintf(os.Stderr, "unknown language %q, expected tr or en\n", *lang)
+		os.Exit(exitUsage)
+	}
+	if *depthUnit != depthUnitKm && *depthUnit != depthUnitM {
+		fmt.Fprintf(os.Stderr, "unknown depth unit %q, expected km or m\n", *depthUnit)
+		os.Exit(exitUsage)
+	}
+	switch *unknownDepthPolicy {
+	case unknownDepthShallow, unknownDepthDeep, unknownDepthExclude:
+	default:
+		fmt.Fprintf(
+			os.Stderr,
+			"unknown depth policy %q, expected shallow, deep or exclude\n",
+			*unknownDepthPolicy,
+		)
+		os.Exit(exitUsage)
+	}
+	if *coordPrecision < 0 || *coordPrecision > maxCoordPrecision {
+		fmt.Fprintf(
+			os.Stderr,
+			"coordinate precision must be between 0 and %d, got %d\n",
+			maxCoordPrecision,
+			*coordPrecision,
+		)
+		os.Exit(exitUsage)
+	}
+	if *minCoordPrecision < 0 {
+		fmt.Fprintf(os.Stderr, "minimum coordinate precision must not be negative, got %d\n", *minCoordPrecision)
+		os.Exit(exitUsage)
+	}
+	if *sample < 0 {
+		fmt.Fprintf(os.Stderr, "sample must not be negative, got %d\n", *sample)
+		os.Exit(exitUsage)
+	}
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if *topProvinces < 0 {
+		fmt.Fprintf(os.Stderr, "top provinces must not be negative, got %d\n", *topProvinces)
+		os.Exit(exitUsage)
+	}
+	switch *uniqueByFlag {
+	case uniqueByTime, uniqueByMagnitude:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown unique by %q, expected time or magnitude\n", *uniqueByFlag)
+		os.Exit(exitUsage)
+	}
+	uniqueBy := ""
+	if *uniqueLocations {
+		uniqueBy = *uniqueByFlag
+	}
+	var matrix []DepthBand
+	if *matrixFlag != "" {
+		var err error
+		if matrix, err = readMatrix(*matrixFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	}
+	headers, err := parseHeaders(headerValues)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	format := *formatFlag
+	if *tsv {
+		format = formatTSV
+	}
+	if *rss {
+		format = formatRSS
+	}
+	if !isFormat(format) {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text, tsv, jsonl, region-jsonl or rss\n", format)
+		os.Exit(exitUsage)
+	}
+	if *tee != "" {
+		outputs = append(outputs, *tee)
+	}
+	if len(outputs) == 0 && *pipeTo == "" {
+		outputs = stringsFlag{"-"}
+	}
+	destinations := make([]Destination, len(outputs))
+	for i, output := range outputs {
+		destinations[i] = parseDestination(output, format)
+		if err := validateDestination(destinations[i].Target); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *tee != "" && !writesToStdout(destinations) {
+		destinations = append(destinations, Destination{Target: "-", Format: format})
+	}
 	return Config{
-		All:          *all,
-		MaxDepth:     float32(*maxDepth),
-		MinMagnitude: float32(*minMagnitude),
+		All:                  *all,
+		MaxDepth:             float32(*maxDepth),
+		MinMagnitude:         float32(*minMagnitude),
+		Deadline:             *deadline,
+		Format:               format,
+		Fault:                *fault,
+		DepthUnit:            *depthUnit,
+		QuietErrors:          *quietErrors,
+		RegexFlags:           *regexFlags,
+		DebugCoords:          *debugCoords,
+		Lang:                 *lang,
+		Source:               *source,
+		Staleness:            *staleness,
+		BestEffort:           *bestEffort,
+		MagBars:              *magBars,
+		FailOnEmpty:          *failOnEmpty,
+		NoTrailingNewline:    *noTrailingNewline,
+		Outputs:              destinations,
+		MagnitudeRound:       *magnitudeRound,
+		BothTimes:            *bothTimes,
+		Percentile:           *percentileFlag,
+		Strict:               *strict,
+		PipeTo:               *pipeTo,
+		CountOnly:            *countOnly,
+		Label:                *label,
+		Nagios:               *nagios,
+		WarningCount:         *warningCount,
+		CriticalCount:        *criticalCount,
+		SummaryJSON:          *summaryJSON,
+		Regions:              splitList(*regions),
+		ExcludeRegions:       splitList(*excludeRegions),
+		Stdin:                *stdin,
+		CheckUpdate:          *checkUpdate,
+		MapLinks:             *mapLinks,
+		Hyperlinks:           *hyperlinks,
+		Head:                 *head,
+		Tail:                 *tail,
+		Sort:                 *sortKey,
+		SortDecay:            *sortDecay,
+		Sanity:               *sanity,
+		Accessible:           *accessible,
+		Trace:                *trace,
+		Headers:              headers,
+		ColorDepth:           *colorDepth,
+		ParseLine:            *parseLineFlag,
+		Footer:               *footer,
+		UnknownDepthPolicy:   *unknownDepthPolicy,
+		MagnitudeBar:         *magnitudeBarFlag,
+		Matrix:               matrix,
+		ShowDepthStars:       *showDepthStars,
+		Reverse:              *reverse || *reverseShort,
+		UniqueBy:             uniqueBy,
+		JSONNumbersAsStrings: *jsonNumbersAsStrings,
+		TopProvinces:         *topProvinces,
+		Sample:               *sample,
+		Seed:                 seed,
+		NoHeader:             *noHeader,
+		CoordPrecision:       *coordPrecision,
+		Emoji:                *emoji,
+		Number:               *number || *numberShort,
+		MinCoordPrecision:    *minCoordPrecision,
+		Insecure:             *insecure,
 	}
 }
 
-func getEarthquakes(cfg Config) []Earthquake {
-	page, err := getObservatoryPage(observatoryURL)
-	if err != nil {
-		fmt.Printf("error while getting observatory page: %s", err)
-		os.Exit(1)
+// Source is a provider of recent earthquakes. Sources return every event they
+// can get, filtering is left to the caller.
+type Source interface {
+	GetEarthquakes(ctx context.Context, cfg Config) ([]Earthquake, error)
+}
+
+var sources = map[string]Source{
+	"koeri": KOERISource{URL: observatoryURL},
+	"afad":  AFADSource{URL: afadURL},
+}
+
+func getEarthquakes(ctx context.Context, cfg Config) ([]Earthquake, error) {
+	all, err := sources[cfg.Source].GetEarthquakes(ctx, cfg)
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "warning: deadline exceeded, results may be partial: %s\n", err)
+	} else if err != nil && cfg.BestEffort {
+		fmt.Fprintf(os.Stderr, "error while getting earthquakes: %s\n", err)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// AFAD filters by magnitude on its side unless -a is set, and in quiet
+	// times the newest earthquake above the threshold is often hours old.
+	_, isAFAD := sources[cfg.Source].(AFADSource)
+	if cfg.Staleness > 0 && !(isAFAD && !cfg.All) {
+		warnIfStale(all, cfg.Staleness)
+	}
+	minPercentileMagnitude := math.Inf(-1)
+	if cfg.Percentile > 0 && len(all) > 0 {
+		mags := make([]float64, len(all))
+		for i, eq := range all {
+			mags[i] = float64(eq.Magnitude)
+		}
+		minPercentileMagnitude = percentile(mags, cfg.Percentile)
 	}
 	var eqs []Earthquake
+	for _, eq := range all {
+		if cfg.DebugCoords {
+			printDebugCoords(os.Stderr, eq)
+		}
+		if !cfg.All && !isImportant(cfg, eq) {
+			continue
+		}
+		if cfg.Fault != "" && !faults[cfg.Fault].Contains(eq.LatLon()) {
+			continue
+		}
+		if eq.coordDecimals < cfg.MinCoordPrecision {
+			continue
+		}
+		if float64(eq.Magnitude) < minPercentileMagnitude {
+			continue
+		}
+		if len(cfg.Regions) > 0 && !inAnyPlace(eq, cfg.Regions) {
+			continue
+		}
+		if inAnyPlace(eq, cfg.ExcludeRegions) {
+			continue
+		}
+		eqs = append(eqs, eq)
+	}
+	if cfg.TopProvinces > 0 {
+		eqs = topRegions(eqs, cfg.TopProvinces)
+	}
+	if cfg.UniqueBy != "" {
+		eqs = uniqueRegions(eqs, cfg.UniqueBy)
+	}
+	if cfg.Sample > 0 {
+		eqs = sampleEarthquakes(eqs, cfg.Sample, cfg.Seed)
+	}
+	return eqs, nil
+}
+
+// sampleEarthquakes keeps n earthquakes chosen uniformly at random with the
+// seed, in their original order.
+func sampleEarthquakes(eqs []Earthquake, n int, seed int64) []Earthquake {
+	if len(eqs) <= n {
+		return eqs
+	}
+	indexes := rand.New(rand.NewSource(seed)).Perm(len(eqs))[:n]
+	sort.Ints(indexes)
+	sampled := make([]Earthquake, n)
+	for i, index := range indexes {
+		sampled[i] = eqs[index]
+	}
+	return sampled
+}
+
+// rankRegions returns the regions of the earthquakes, the ones with the most
+// earthquakes first, and their earthquake counts. Regions with as many
+// earthquakes are ranked in the order they first appear.
+func rankRegions(eqs []Earthquake) ([]string, map[string]int) {
+	var regions []string
+	counts := map[string]int{}
+	for _, eq := range eqs {
+		if counts[eq.Region()] == 0 {
+			regions = append(regions, eq.Region())
+		}
+		counts[eq.Region()]++
+	}
+	sort.SliceStable(regions, func(i, j int) bool {
+		return counts[regions[i]] > counts[regions[j]]
+	})
+	return regions, counts
+}
+
+// topRegions keeps the earthquakes of the n regions ranked first by
+// rankRegions.
+func topRegions(eqs []Earthquake, n int) []Earthquake {
+	regions, _ := rankRegions(eqs)
+	if len(regions) > n {
+		regions = regions[:n]
+	}
+	isTop := map[string]bool{}
+	for _, region := range regions {
+		isTop[region] = true
+	}
+	var top []Earthquake
+	for _, eq := range eqs {
+		if isTop[eq.Region()] {
+			top = append(top, eq)
+		}
+	}
+	return top
+}
+
+const (
+	uniqueByTime      = "time"
+	uniqueByMagnitude = "magnitude"
+)
+
+// uniqueRegions keeps the most recent or the largest earthquake of every
+// region, in the order the regions first appear.
+func uniqueRegions(eqs []Earthquake, by string) []Earthquake {
+	var unique []Earthquake
+	indexes := map[string]int{}
+	for _, eq := range eqs {
+		i, ok := indexes[eq.Region()]
+		if !ok {
+			indexes[eq.Region()] = len(unique)
+			unique = append(unique, eq)
+			continue
+		}
+		kept := unique[i]
+		if by == uniqueByMagnitude && eq.Magnitude > kept.Magnitude ||
+			by == uniqueByTime && eq.Time.After(kept.Time) {
+			unique[i] = eq
+		}
+	}
+	return unique
+}
+
+// percentile returns the pth percentile of the values, interpolating linearly
+// between the closest ranks. values must not be empty, it is sorted in place.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := p / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return values[lower] + (rank-float64(lower))*(values[upper]-values[lower])
+}
+
+// warnIfStale warns when the newest of the earthquakes is older than the
+// threshold, which usually means the observatory stopped updating its list.
+func warnIfStale(eqs []Earthquake, threshold time.Duration) {
+	if len(eqs) == 0 {
+		return
+	}
+	newest := eqs[0].Time
+	for _, eq := range eqs[1:] {
+		if eq.Time.After(newest) {
+			newest = eq.Time
+		}
+	}
+	if age := time.Since(newest); age > threshold {
+		fmt.Fprintf(
+			os.Stderr,
+			"WARNING: observatory data may be stale — newest event is %s old\n",
+			humanizeDuration(age),
+		)
+	}
+}
+
+// humanizeTime formats the time passed since t, e.g. 12m ago.
+func humanizeTime(t, now time.Time) string {
+	return humanizeDuration(now.Sub(t)) + " ago"
+}
+
+// durationUnits are the units of the humanized durations, largest first.
+var durationUnits = []struct {
+	size        time.Duration
+	short, long string
+}{
+	{24 * time.Hour, "d", "day"},
+	{time.Hour, "h", "hour"},
+	{time.Minute, "m", "minute"},
+	{time.Second, "s", "second"},
+}
+
+// humanizeDuration formats a duration with its largest unit only, e.g. 8h or
+// 12m.
+func humanizeDuration(d time.Duration) string {
+	for _, unit := range durationUnits {
+		if d >= unit.size || unit.size == time.Second {
+			return fmt.Sprintf("%d%s", int(d/unit.size), unit.short)
+		}
+	}
+	return ""
+}
+
+// humanizeDurationWords is humanizeDuration with the unit spelled out, e.g.
+// 5 minutes.
+func humanizeDurationWords(d time.Duration) string {
+	for _, unit := range durationUnits {
+		if d >= unit.size || unit.size == time.Second {
+			n := int(d / unit.size)
+			if n == 1 {
+				return fmt.Sprintf("%d %s", n, unit.long)
+			}
+			return fmt.Sprintf("%d %ss", n, unit.long)
+		}
+	}
+	return ""
+}
+
+// KOERISource reads the latest earthquakes list of the Kandilli Observatory.
+type KOERISource struct {
+	URL string
+}
+
+// GetEarthquakes returns the earthquakes parsed so far along with the error
+// when the context deadline is exceeded.
+func (s KOERISource) GetEarthquakes(ctx context.Context, cfg Config) ([]Earthquake, error) {
+	var page string
+	var err error
+	if cfg.Stdin {
+		var pageBytes []byte
+		pageBytes, err = io.ReadAll(os.Stdin)
+		if err == nil {
+			page, err = decodePage("", string(pageBytes))
+		}
+	} else {
+		page, err = getObservatoryPage(ctx, s.URL)
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("error while getting observatory page: %w", err)
+	}
+	var eqs []Earthquake
+	matched, skipped := 0, 0
 	for _, line := range strings.Split(page, "\n") {
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
 		if !eqLineRegex.MatchString(line) {
 			continue
 		}
-		eq, err := parseLine(line)
-		if err != nil {
-			fmt.Printf("error while parsing earthquake line line=%s: %s", line, err)
+		matched++
+		if colErr := checkColumns(line); colErr != nil && cfg.Strict {
+			skipped++
+			if !cfg.QuietErrors {
+				fmt.Fprintf(os.Stderr, "error while checking earthquake line line=%s: %s\n", line, colErr)
+			}
 			continue
+		} else if colErr != nil && !cfg.QuietErrors {
+			fmt.Fprintf(os.Stderr, "warning: %s, line=%s\n", colErr, line)
 		}
-		if !cfg.All && !isImportant(cfg, eq) {
+		eq, parseErr := parseLine(line)
+		if parseErr != nil {
+			skipped++
+			if !cfg.QuietErrors {
+				fmt.Fprintf(os.Stderr, "error while parsing earthquake line line=%s: %s\n", line, parseErr)
+			}
 			continue
 		}
+		if cfg.Sanity {
+			if err := checkCoordinates(eq); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s, line=%s\n", err, line)
+			}
+		}
 		eqs = append(eqs, eq)
 	}
-	return eqs
+	if cfg.QuietErrors && skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d unparseable lines\n", skipped)
+	}
+	if len(eqs) == 0 && skipped > 0 && err == nil {
+		return nil, fmt.Errorf("%w, skipped %d lines", ErrFormatChanged, skipped)
+	}
+	if matched == 0 && err == nil && (cfg.Strict || looksLikeErrorPage(page)) {
+		return nil, fmt.Errorf("%w, url=%s", errUnexpectedPage, s.URL)
+	}
+	return eqs, err
+}
+
+// printDebugCoords prints the parsed coordinates of the earthquake and its
+// distance to the observatory.
+func printDebugCoords(w io.Writer, eq Earthquake) {
+	fmt.Fprintf(
+		w,
+		"debug: %s lat=%.4f lon=%.4f distance=%.1fkm\n",
+		eq.Location,
+		eq.Latitude,
+		eq.Longitude,
+		distanceKm(kandilli, eq.LatLon()),
+	)
+}
+
+// koeriColumns are the offsets of the fixed width columns of the KOERI list
+// from the start of the date, keyed by their submatch index in eqLineRegex.
+// Only the left aligned columns are listed, the rest are padded by value.
+var koeriColumns = []struct {
+	name   string
+	group  int
+	offset int
+}{
+	{"time", 2, 11},
+	{"latitude", 3, 21},
+	{"longitude", 4, 31},
+}
+
+// checkColumns reports whether the columns of the line start where the KOERI
+// list puts them. A shift means the format changed even if the line still
+// matches the pattern.
+func checkColumns(line string) error {
+	indices := eqLineRegex.FindStringSubmatchIndex(line)
+	if indices == nil {
+		return fmt.Errorf("line does not match the earthquake pattern")
+	}
+	start := indices[2]
+	for _, col := range koeriColumns {
+		if offset := indices[2*col.group] - start; offset != col.offset {
+			return fmt.Errorf(
+				"%s column starts at %d instead of %d",
+				col.name,
+				offset,
+				col.offset,
+			)
+		}
+	}
+	return nil
+}
+
+// turkeyBounds is a rough bounding box of Turkey with about a degree of
+// margin. KOERI lists earthquakes around Turkey only.
+var turkeyBounds = struct {
+	minLat, maxLat, minLon, maxLon float64
+}{34.5, 43.0, 24.5, 45.5}
+
+// checkCoordinates reports earthquakes outside of turkeyBounds, which usually
+// means the coordinates were misread. Swapped coordinates are only caught when
+// they fall outside of the box, most points of eastern Turkey stay inside it.
+func checkCoordinates(eq Earthquake) error {
+	if eq.Latitude < turkeyBounds.minLat || eq.Latitude > turkeyBounds.maxLat ||
+		eq.Longitude < turkeyBounds.minLon || eq.Longitude > turkeyBounds.maxLon {
+		return fmt.Errorf(
+			"coordinates lat=%.4f lon=%.4f are outside of Turkey",
+			eq.Latitude,
+			eq.Longitude,
+		)
+	}
+	return nil
 }
 
-func getObservatoryPage(url string) (string, error) {
-	resp, err := http.Get(url)
+// looksLikeErrorPage reports whether the page is an HTML page without the
+// preformatted block the earthquake list is printed in. Servers sometimes
+// respond to failures with such pages and a 200 status.
+func looksLikeErrorPage(page string) bool {
+	page = strings.ToLower(page)
+	return strings.Contains(page, "<html") && !strings.Contains(page, "<pre")
+}
+
+// getObservatoryPage fetches the observatory page. When the context deadline is
+// exceeded while reading the body, the part read so far is returned along with
+// the error.
+func getObservatoryPage(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error while creating observatory request, url=%s: %w", url, err)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf(
-			"error while getting earthquakes from observatory, url=%s: %w",
+			"error while getting earthquakes from observatory, url=%s: %w: %w",
 			url,
+			ErrObservatoryUnreachable,
 			err,
 		)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", &httpStatusError{Server: "observatory", URL: url, StatusCode: resp.StatusCode}
+	}
 	bodyBytes, err := io.ReadAll(resp.Body)
+	page, decodeErr := decodePage(resp.Header.Get("Content-Type"), string(bodyBytes))
+	if decodeErr != nil {
+		return "", fmt.Errorf("error while decoding response from observatory, url=%s: %w", url, decodeErr)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error while reading response from observatory, url=%s: %w", url, err)
+		return page, fmt.Errorf("error while reading response from observatory, url=%s: %w", url, err)
 	}
-	return string(bodyBytes), nil
+	return page, nil
+}
+
+// printParsedLine parses the line, or the first line of stdin when it is -,
+// and prints the earthquake, or the parse error as {"error": "..."}, as JSON
+// for -parse-line. It returns the exit code.
+func printParsedLine(w io.Writer, cfg Config, line string) int {
+	if line == "-" {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "error while reading line from stdin: %s\n", err)
+			return exitUnknown
+		}
+		line = scanner.Text()
+	}
+	enc := json.NewEncoder(w)
+	eq, err := parseLine(line)
+	if err != nil {
+		enc.Encode(struct {
+			Error string `json:"error"`
+		}{err.Error()})
+		return exitParse
+	}
+	if err := enc.Encode(jsonEarthquake(cfg, eq)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUnknown
+	}
+	return exitOK
 }
 
 func parseLine(line string) (Earthquake, error) {
 	matches := eqLineRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return Earthquake{}, errors.New("parseLine: line does not match the earthquake line format")
+	}
 	datetimeStr := fmt.Sprintf("%s %s", matches[1], matches[2])
 	turkeyLoc, err := time.LoadLocation("Europe/Istanbul")
 	if err != nil {
-		return Earthquake{}, fmt.Errorf("error while parsing location string: %s", err)
+		return Earthquake{}, fmt.Errorf("parseLine: parse time zone Europe/Istanbul: %w", err)
 	}
 	datetime, err := time.ParseInLocation("2006.01.02 15:04:05", datetimeStr, turkeyLoc)
 	if err != nil {
-		return Earthquake{}, fmt.Errorf(
-			"error while parsing date of the earthquake datetimeStr=%s: %w",
-			datetimeStr,
-			err,
-		)
+		return Earthquake{}, fmt.Errorf("parseLine: parse date: %w", err)
 	}
 	latStr := matches[3]
 	lat, err := strconv.ParseFloat(latStr, 64)
 	if err != nil {
-		return Earthquake{}, fmt.Errorf(
-			"error while parsing latitude of the earthquake latStr=%s: %w",
-			latStr,
-			err,
-		)
+		return Earthquake{}, fmt.Errorf("parseLine: parse latitude: %w", err)
 	}
 	longStr := matches[4]
 	long, err := strconv.ParseFloat(longStr, 64)
 	if err != nil {
-		return Earthquake{}, fmt.Errorf(
-			"error while parsing longitude of the earthquake latStr=%s: %w",
-			longStr,
-			err,
-		)
+		return Earthquake{}, fmt.Errorf("parseLine: parse longitude: %w", err)
 	}
 	depthStr := matches[5]
 	depth, err := strconv.ParseFloat(depthStr, 32)
 	if err != nil {
-		return Earthquake{}, fmt.Errorf(
-			"error while parsing depth of the earthquake depthStr=%s: %w",
-			depthStr,
-			err,
-		)
+		return Earthquake{}, fmt.Errorf("parseLine: parse depth: %w", err)
 	}
 	magStr := matches[6]
 	mag, err := strconv.ParseFloat(magStr, 32)
 	if err != nil {
-		return Earthquake{}, fmt.Errorf(
-			"error while parsing magnitude of the earthquake magStr=%s: %w",
-			magStr,
-			err,
-		)
+		return Earthquake{}, fmt.Errorf("parseLine: parse magnitude: %w", err)
 	}
 	epicenter := matches[7]
-	province := matches[8]
+	district := matches[8]
+	province := matches[9]
 	localLoc, err := time.LoadLocation("Local")
 	if err != nil {
-		return Earthquake{}, fmt.Errorf("error while parsing time location: %s", err)
+		return Earthquake{}, fmt.Errorf("parseLine: parse local time zone: %w", err)
 	}
 	return Earthquake{
-		Location:  fmt.Sprintf("%s %s", province, epicenter),
+		Location:  fmt.Sprintf("%s %s", district, epicenter),
+		Province:  province,
 		Latitude:  lat,
 		Longitude: long,
 		Time:      datetime.In(localLoc),
 		Magnitude: float32(mag),
 		Depth:     float32(depth),
+
+		coordDecimals: coordDecimals(latStr, longStr),
 	}, nil
 }
 
+// coordDecimals returns the fewest decimal places of the reported latitude and
+// longitude.
+func coordDecimals(lat, long string) int {
+	latDecimals, longDecimals := decimalPlaces(lat), decimalPlaces(long)
+	if latDecimals < longDecimals {
+		return latDecimals
+	}
+	return longDecimals
+}
+
+func decimalPlaces(number string) int {
+	_, fraction, _ := strings.Cut(number, ".")
+	return len(fraction)
+}
+
+func (eq Earthquake) LatLon() LatLon {
+	return LatLon{Latitude: eq.Latitude, Longitude: eq.Longitude}
+}
+
+// sortEarthquakes sorts the earthquakes in place, the most relevant first
+// unless Reverse is set.
+func sortEarthquakes(cfg Config, now time.Time, eqs []Earthquake) {
+	var less func(a, b Earthquake) bool
+	switch cfg.Sort {
+	case sortMagnitude:
+		less = func(a, b Earthquake) bool { return a.Magnitude > b.Magnitude }
+	case sortRecencyWeightedMagnitude:
+		less = func(a, b Earthquake) bool {
+			return recencyWeightedMagnitude(a, now, cfg.SortDecay) >
+				recencyWeightedMagnitude(b, now, cfg.SortDecay)
+		}
+	default:
+		less = func(a, b Earthquake) bool { return a.Time.After(b.Time) }
+	}
+	if cfg.Reverse {
+		forward := less
+		less = func(a, b Earthquake) bool { return forward(b, a) }
+	}
+	sort.SliceStable(eqs, func(i, j int) bool { return less(eqs[i], eqs[j]) })
+}
+
+// recencyWeightedMagnitude scores an earthquake by its magnitude minus one
+// unit for every decay that passed since it happened:
+//
+//	score = magnitude - age / decay
+//
+// With a 12h decay, a 5.0 from a day ago ranks with a 3.0 from now. As the
+// magnitude scale is logarithmic this is an exponential decay of the released
+// energy.
+func recencyWeightedMagnitude(eq Earthquake, now time.Time, decay time.Duration) float64 {
+	age := now.Sub(eq.Time)
+	return float64(eq.Magnitude) - float64(age)/float64(decay)
+}
+
+const (
+	magnitudeRoundNearest = "nearest"
+	magnitudeRoundUp      = "up"
+	magnitudeRoundDown    = "down"
+	// magnitudeRoundStep is half of the precision the magnitudes are
+	// reported with.
+	magnitudeRoundStep = 0.05
+)
+
+// headTail keeps the first Head and last Tail earthquakes when they are set.
+// It returns the index where the left out earthquakes were, or 0 if none were
+// left out between the head and the tail.
+func headTail(cfg Config, eqs []Earthquake) ([]Earthquake, int) {
+	head, tail := cfg.Head, cfg.Tail
+	switch {
+	case head <= 0 && tail <= 0:
+		return eqs, 0
+	case head > 0 && tail > 0:
+		if head+tail >= len(eqs) {
+			return eqs, 0
+		}
+		return append(eqs[:head:head], eqs[len(eqs)-tail:]...), head
+	case head > 0:
+		if head > len(eqs) {
+			head = len(eqs)
+		}
+		return eqs[:head], 0
+	default:
+		if tail > len(eqs) {
+			tail = len(eqs)
+		}
+		return eqs[len(eqs)-tail:], 0
+	}
+}
+
+// Summary is a digest of a list of earthquakes.
+type Summary struct {
+	Count        int       `json:"count"`
+	MaxMagnitude float32   `json:"maxMagnitude"`
+	MinDepth     float32   `json:"minDepth"`
+	DepthUnit    string    `json:"depthUnit"`
+	NewestTime   time.Time `json:"newestTime"`
+	Regions      []string  `json:"regions"`
+}
+
+// summarize digests the earthquakes, leaving the fields zero when there are
+// none. Regions are listed in the order they first appear.
+func summarize(eqs []Earthquake) Summary {
+	summary := Summary{Count: len(eqs), Regions: []string{}}
+	seen := map[string]bool{}
+	for i, eq := range eqs {
+		if i == 0 || eq.Magnitude > summary.MaxMagnitude {
+			summary.MaxMagnitude = eq.Magnitude
+		}
+		if i == 0 || eq.Depth < summary.MinDepth {
+			summary.MinDepth = eq.Depth
+		}
+		if eq.Time.After(summary.NewestTime) {
+			summary.NewestTime = eq.Time
+		}
+		if region := eq.Region(); !seen[region] {
+			seen[region] = true
+			summary.Regions = append(summary.Regions, region)
+		}
+	}
+	return summary
+}
+
+// inAnyPlace reports whether any of the places is a word, or a sequence of
+// words, of the earthquake location or province. Comparison ignores case and
+// Turkish letters.
+func inAnyPlace(eq Earthquake, places []string) bool {
+	words := placeWordRegex.FindAllString(foldTurkish(eq.Location+" "+eq.Province), -1)
+	location := " " + strings.Join(words, " ") + " "
+	for _, place := range places {
+		place = strings.Join(placeWordRegex.FindAllString(foldTurkish(place), -1), " ")
+		if place != "" && strings.Contains(location, " "+place+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// Region returns the province of the earthquake or, for earthquakes at sea
+// that have none, the location.
+func (eq Earthquake) Region() string {
+	if eq.Province != "" {
+		return eq.Province
+	}
+	return eq.Location
+}
+
+// depthStarLimits are the depths in kilometers below which an earthquake gets
+// five, four, three and two stars. Deeper ones get one.
+var depthStarLimits = []float32{10, 20, 40, 70}
+
+// DepthStar returns one to five stars, more for shallower earthquakes as they
+// are felt stronger at the surface.
+func (eq Earthquake) DepthStar() string {
+	stars := 1
+	for i, limit := range depthStarLimits {
+		if eq.Depth < limit {
+			stars = len(depthStarLimits) + 1 - i
+			break
+		}
+	}
+	return strings.Repeat("★", stars)
+}
+
+const (
+	unknownDepthShallow = "shallow"
+	unknownDepthDeep    = "deep"
+	unknownDepthExclude = "exclude"
+)
+
 func isImportant(cfg Config, eq Earthquake) bool {
-	return eq.Magnitude > cfg.MinMagnitude && eq.Depth < cfg.MaxDepth
+	if eq.Depth == 0 && cfg.UnknownDepthPolicy == unknownDepthExclude {
+		return false
+	}
+	if len(cfg.Matrix) > 0 {
+		return matrixMatches(cfg, eq)
+	}
+	return comparedMagnitude(cfg, eq.Magnitude) > cfg.MinMagnitude &&
+		comparedDepth(cfg, eq.Depth) < cfg.MaxDepth
+}
+
+// DepthBand is a row of -matrix, the minimum magnitude of earthquakes
+// shallower than MaxDepth and at least as deep as the band before.
+type DepthBand struct {
+	MaxDepth     float32
+	MinMagnitude float32
+}
+
+// readMatrix parses the -matrix value, reading it from a file when it starts
+// with @.
+func readMatrix(value string) ([]DepthBand, error) {
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading matrix file: %w", err)
+		}
+		value = string(data)
+	}
+	return parseMatrix(value)
+}
+
+// parseMatrix parses depth:magnitude bands separated by commas or white space.
+// The depths must be increasing, so every depth falls in at most one band.
+func parseMatrix(value string) ([]DepthBand, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("empty matrix, expected depth:magnitude bands")
+	}
+	bands := make([]DepthBand, len(fields))
+	for i, field := range fields {
+		depthStr, magStr, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid matrix band %q, expected depth:magnitude", field)
+		}
+		depth, err := strconv.ParseFloat(depthStr, 32)
+		if err != nil || depth <= 0 || math.IsNaN(depth) {
+			return nil, fmt.Errorf("invalid depth in matrix band %q, expected a positive number or inf", field)
+		}
+		mag, err := strconv.ParseFloat(magStr, 32)
+		if err != nil || math.IsInf(mag, 0) || math.IsNaN(mag) {
+			return nil, fmt.Errorf("invalid magnitude in matrix band %q", field)
+		}
+		if i > 0 && float32(depth) <= bands[i-1].MaxDepth {
+			return nil, fmt.Errorf("matrix depths must be increasing, got %q after %g", field, bands[i-1].MaxDepth)
+		}
+		bands[i] = DepthBand{MaxDepth: float32(depth), MinMagnitude: float32(mag)}
+	}
+	return bands, nil
+}
+
+// lowestMinMagnitude returns the smallest magnitude threshold of -m or of the
+// -matrix bands, for sources that filter on their side.
+func lowestMinMagnitude(cfg Config) float32 {
+	if len(cfg.Matrix) == 0 {
+		return cfg.MinMagnitude
+	}
+	lowest := cfg.Matrix[0].MinMagnitude
+	for _, band := range cfg.Matrix[1:] {
+		if band.MinMagnitude < lowest {
+			lowest = band.MinMagnitude
+		}
+	}
+	return lowest
+}
+
+// matrixMatches reports whether the earthquake is above the minimum magnitude
+// of its depth band. Earthquakes deeper than every band never match.
+func matrixMatches(cfg Config, eq Earthquake) bool {
+	depth := comparedDepth(cfg, eq.Depth)
+	for _, band := range cfg.Matrix {
+		if depth < band.MaxDepth {
+			return comparedMagnitude(cfg, eq.Magnitude) > band.MinMagnitude
+		}
+	}
+	return false
 }
 
-func printEarthquakes(eqs []Earthquake) {
+// comparedDepth returns the depth to compare with the thresholds. The
+// observatory reports 0.0 when the depth could not be determined, which is
+// compared as it is by default.
+func comparedDepth(cfg Config, depth float32) float32 {
+	if depth == 0 && cfg.UnknownDepthPolicy == unknownDepthDeep {
+		return float32(math.Inf(1))
+	}
+	return depth
+}
+
+// comparedMagnitude returns the magnitude to compare with the thresholds. The
+// sources round magnitudes to one decimal, so a reported 4.5 may be anything
+// in [4.45, 4.55). By default the reported value is used as it is.
+func comparedMagnitude(cfg Config, mag float32) float32 {
+	switch cfg.MagnitudeRound {
+	case magnitudeRoundUp:
+		return mag + magnitudeRoundStep
+	case magnitudeRoundDown:
+		return mag - magnitudeRoundStep
+	default:
+		return mag
+	}
+}
+
+// formatDepth formats a depth given in kilometers in the configured unit,
+// without the unit label.
+func formatDepth(cfg Config, depth float32) string {
+	if cfg.DepthUnit == depthUnitM {
+		return fmt.Sprintf("%.0f", depthInUnit(cfg, depth))
+	}
+	return fmt.Sprintf("%02.1f", depth)
+}
+
+// depthInUnit converts a depth given in kilometers to the configured unit.
+func depthInUnit(cfg Config, depth float32) float32 {
+	if cfg.DepthUnit == depthUnitM {
+		return depth * 1000
+	}
+	return depth
+}
+
+func printEarthquakes(w io.Writer, cfg Config, eqs []Earthquake) {
 	if len(eqs) == 0 {
-		fmt.Println("No important earthquakes recently")
+		fmt.Fprintln(w, "No important earthquakes recently")
 		return
 	}
+	if cfg.TopProvinces > 0 {
+		printRegionCounts(w, eqs)
+	}
 	maxLocLength := 0
 	for _, eq := range eqs {
 		if maxLocLength < len(eq.Location) {
 			maxLocLength = len(eq.Location)
 		}
 	}
+	numberWidth := len(strconv.Itoa(len(eqs)))
+	now := timeNow()
+	for i, eq := range eqs {
+		if i > 0 && i == cfg.elidedAt {
+			fmt.Fprintln(w, "...")
+		}
+		eqTime := eq.Time.Format(time.DateTime)
+		if cfg.BothTimes {
+			eqTime = fmt.Sprintf("%s (%s)", eqTime, humanizeTime(eq.Time, now))
+		}
+		bar := ""
+		if cfg.MagBars {
+			bar = " " + magnitudeBar(eq.Magnitude)
+		}
+		link := ""
+		if cfg.MapLinks {
+			link = "\t" + mapLink(cfg, eq)
+		}
+		stars := ""
+		if cfg.ShowDepthStars {
+			stars = " " + eq.DepthStar()
+		}
+		level := ""
+		if cfg.MagnitudeBar {
+			level = "\t" + magnitudeLevel(eq.Magnitude)
+		}
+		if cfg.Number {
+			fmt.Fprintf(w, "%*d  ", numberWidth, i+1)
+		}
+		if cfg.Emoji {
+			fmt.Fprint(w, magnitudeEmoji(eq.Magnitude)+" ")
+		}
+		formatStr := fmt.Sprintf("%%-%ds\t%%1.1fM%%s\t%%s\t%%s%%s%%s\n", maxLocLength)
+		fmt.Fprintf(
+			w,
+			formatStr,
+			eq.Location,
+			eq.Magnitude,
+			bar,
+			colorizeDepth(cfg, eq.Depth, formatDepth(cfg, eq.Depth)+cfg.DepthUnit)+stars,
+			eqTime,
+			link,
+			level,
+		)
+	}
+}
+
+// printRegionCounts prints a header with the number of earthquakes of every
+// region shown, for -top-provinces.
+func printRegionCounts(w io.Writer, eqs []Earthquake) {
+	regions, counts := rankRegions(eqs)
+	parts := make([]string, len(regions))
+	for i, region := range regions {
+		parts[i] = fmt.Sprintf("%s (%d)", region, counts[region])
+	}
+	fmt.Fprintf(w, "Top provinces: %s\n", strings.Join(parts, ", "))
+}
+
+// magnitudeEmojis maps upper magnitude limits to the emojis of -emoji. They
+// are all two columns wide, so the table stays aligned.
+var magnitudeEmojis = []struct {
+	maxMagnitude float32
+	emoji        string
+}{
+	{3, "🟢"},
+	{4, "🟡"},
+	{5, "🟠"},
+	{float32(math.Inf(1)), "🔴"},
+}
+
+func magnitudeEmoji(mag float32) string {
+	for _, e := range magnitudeEmojis {
+		if mag < e.maxMagnitude {
+			return e.emoji
+		}
+	}
+	return magnitudeEmojis[len(magnitudeEmojis)-1].emoji
+}
+
+// depthColors maps upper depth limits in kilometers to ANSI colors, from red
+// for the shallow earthquakes that are felt the most to blue for deep ones.
+var depthColors = []struct {
+	maxDepth float32
+	color    string
+}{
+	{10, "\x1b[31m"},
+	{30, "\x1b[33m"},
+	{70, "\x1b[36m"},
+	{float32(math.Inf(1)), "\x1b[34m"},
+}
+
+func depthColor(depth float32) string {
+	for _, c := range depthColors {
+		if depth < c.maxDepth {
+			return c.color
+		}
+	}
+	return depthColors[len(depthColors)-1].color
+}
+
+// colorizeDepth wraps the formatted depth in the color of the depth with
+// -color-depth.
+func colorizeDepth(cfg Config, depth float32, s string) string {
+	if !cfg.ColorDepth {
+		return s
+	}
+	return depthColor(depth) + s + "\x1b[0m"
+}
+
+// mapURL returns the OpenStreetMap URL of the earthquake epicenter.
+func mapURL(eq Earthquake) string {
+	return fmt.Sprintf(
+		"https://www.openstreetmap.org/?mlat=%.4f&mlon=%.4f#map=10/%.4f/%.4f",
+		eq.Latitude,
+		eq.Longitude,
+		eq.Latitude,
+		eq.Longitude,
+	)
+}
+
+// mapLink returns the map URL, or an OSC 8 hyperlink labeled "map" pointing to
+// it with -hyperlinks.
+func mapLink(cfg Config, eq Earthquake) string {
+	if cfg.Hyperlinks {
+		return "\x1b]8;;" + mapURL(eq) + "\x1b\\map\x1b]8;;\x1b\\"
+	}
+	return mapURL(eq)
+}
+
+// magBarMax is the magnitude that fills the whole magnitude bar.
+const magBarMax = 10
+
+// magnitudeBar renders one block per magnitude unit, padded to magBarMax so
+// the following columns stay aligned.
+func magnitudeBar(mag float32) string {
+	n := int(math.Round(float64(mag)))
+	if n < 0 {
+		n = 0
+	} else if n > magBarMax {
+		n = magBarMax
+	}
+	return strings.Repeat("█", n) + strings.Repeat(" ", magBarMax-n)
+}
+
+// magnitudeLevels are the block characters of -magnitude-bar, from the
+// lowest to the highest.
+var magnitudeLevels = []rune("▁▂▃▄▅▆▇█")
+
+// magnitudeLevelMax is the magnitude shown with the highest block.
+const magnitudeLevelMax = 9
+
+// magnitudeLevel renders the magnitude as a single block character whose
+// height is proportional to it, so the column stays one character wide.
+func magnitudeLevel(mag float32) string {
+	i := int(math.Round(float64(mag) / magnitudeLevelMax * float64(len(magnitudeLevels)-1)))
+	if i < 0 {
+		i = 0
+	} else if i >= len(magnitudeLevels) {
+		i = len(magnitudeLevels) - 1
+	}
+	return string(magnitudeLevels[i])
+}
+
+var tsvReplacer = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+func printTSV(w io.Writer, cfg Config, eqs []Earthquake) {
+	if !cfg.NoHeader {
+		fmt.Fprintf(w, "location\tmagnitude\tdepth_%s\ttime\n", cfg.DepthUnit)
+	}
 	for _, eq := range eqs {
-		formatStr := fmt.Sprintf("%%-%ds\t%%1.1fM\t%%02.1fkm\t%%s\n", maxLocLength)
-		fmt.Printf(formatStr, eq.Location, eq.Magnitude, eq.Depth, eq.Time.Format(time.DateTime))
+		fmt.Fprintf(
+			w,
+			"%s\t%.1f\t%s\t%s\n",
+			tsvReplacer.Replace(eq.Location),
+			eq.Magnitude,
+			formatDepth(cfg, eq.Depth),
+			eq.Time.Format(time.DateTime),
+		)
 	}
 }
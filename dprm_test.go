@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestKOERIDeadlineReturnsPartialData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<pre>")
+		fmt.Fprintln(w, "2023.02.13 11:38:48  38.0820   37.5890        5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	eqs, err := KOERISource{URL: srv.URL}.GetEarthquakes(ctx, Config{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetEarthquakes() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(eqs) != 1 {
+		t.Fatalf("GetEarthquakes() returned %d earthquakes, want the 1 sent before the stall", len(eqs))
+	}
+	if eqs[0].Province != "KAHRAMANMARAS" {
+		t.Errorf("GetEarthquakes()[0].Province = %q, want KAHRAMANMARAS", eqs[0].Province)
+	}
+}
+
+func TestFormatDepth(t *testing.T) {
+	tests := []struct {
+		unit  string
+		depth float32
+		want  string
+	}{
+		{depthUnitKm, 5, "5.0"},
+		{depthUnitKm, 102, "102.0"},
+		{depthUnitM, 8.9, "8900"},
+		{depthUnitM, 0, "0"},
+	}
+	for _, tt := range tests {
+		if got := formatDepth(Config{DepthUnit: tt.unit}, tt.depth); got != tt.want {
+			t.Errorf("formatDepth(%s, %g) = %q, want %q", tt.unit, tt.depth, got, tt.want)
+		}
+	}
+}
+
+// captureStderr returns what f writes to stderr.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestQuietErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<pre>")
+		fmt.Fprintln(w, "2023.02.13 11:38:48  38.0820   37.5890        5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel")
+		fmt.Fprintln(w, "2023.02.30 11:20:02  37.2115   36.8533        7.2      -.-  2.1  -.-   NURDAGI-GAZIANTEP (GAZIANTEP)                     Ilksel")
+		fmt.Fprintln(w, "</pre>")
+	}))
+	defer srv.Close()
+	tests := []struct {
+		quiet bool
+		want  string
+	}{
+		{false, "error while parsing earthquake line line=2023.02.30 11:20:02"},
+		{true, "skipped 1 unparseable lines\n"},
+	}
+	for _, tt := range tests {
+		var eqs []Earthquake
+		var err error
+		stderr := captureStderr(t, func() {
+			eqs, err = KOERISource{URL: srv.URL}.GetEarthquakes(context.Background(), Config{QuietErrors: tt.quiet})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eqs) != 1 {
+			t.Errorf("quiet=%t: GetEarthquakes() returned %d earthquakes, want 1", tt.quiet, len(eqs))
+		}
+		if tt.quiet && stderr != tt.want {
+			t.Errorf("quiet=%t: stderr = %q, want %q", tt.quiet, stderr, tt.want)
+		} else if !strings.HasPrefix(stderr, tt.want) {
+			t.Errorf("quiet=%t: stderr = %q, want it to start with %q", tt.quiet, stderr, tt.want)
+		}
+	}
+}
+
+func TestPrintDebugCoords(t *testing.T) {
+	eq := Earthquake{Location: "KAHRAMANMARAS GOKSUN-KAHRAMANMARAS", Latitude: 38.082, Longitude: 37.589}
+	var buf bytes.Buffer
+	printDebugCoords(&buf, eq)
+	want := "debug: KAHRAMANMARAS GOKSUN-KAHRAMANMARAS lat=38.0820 lon=37.5890 distance=802.1km\n"
+	if buf.String() != want {
+		t.Errorf("printDebugCoords() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPrintVisibleDefaults(t *testing.T) {
+	fs := flag.NewFlagSet("dprm", flag.ContinueOnError)
+	fs.Bool("debug-coords", false, "print parsed coordinates")
+	fs.Bool("quiet-errors", false, "do not print per-line parse errors")
+	fs.String("depth-unit", depthUnitKm, "unit of the displayed depth")
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	if err := fs.Parse([]string{"-depth-unit", depthUnitM}); err != nil {
+		t.Fatal(err)
+	}
+	printVisibleDefaults(fs)
+	if strings.Contains(buf.String(), "debug-coords") {
+		t.Errorf("printVisibleDefaults() shows the hidden flag:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "-quiet-errors") || !strings.Contains(buf.String(), `(default "km")`) {
+		t.Errorf("printVisibleDefaults() misses visible flags or their defaults:\n%s", buf.String())
+	}
+}
+
+func TestMagnitudeBar(t *testing.T) {
+	tests := []struct {
+		mag  float32
+		want int
+	}{
+		{-0.5, 0},
+		{0.4, 0},
+		{2.1, 2},
+		{4.5, 5},
+		{7.8, 8},
+		{12, magBarMax},
+	}
+	for _, tt := range tests {
+		bar := magnitudeBar(tt.mag)
+		if got := strings.Count(bar, "█"); got != tt.want {
+			t.Errorf("magnitudeBar(%g) has %d blocks, want %d", tt.mag, got, tt.want)
+		}
+		if got := utf8.RuneCountInString(bar); got != magBarMax {
+			t.Errorf("magnitudeBar(%g) is %d characters wide, want %d", tt.mag, got, magBarMax)
+		}
+	}
+}
+
+func TestSortRecencyWeightedMagnitude(t *testing.T) {
+	now := time.Date(2023, 2, 13, 12, 0, 0, 0, time.UTC)
+	eqs := []Earthquake{
+		{Location: "old strong", Magnitude: 5.0, Time: now.Add(-48 * time.Hour)},
+		{Location: "recent", Magnitude: 3.5, Time: now.Add(-time.Hour)},
+		{Location: "day old", Magnitude: 4.5, Time: now.Add(-24 * time.Hour)},
+	}
+	cfg := Config{Sort: sortRecencyWeightedMagnitude, SortDecay: 12 * time.Hour}
+	sortEarthquakes(cfg, now, eqs)
+	var got []string
+	for _, eq := range eqs {
+		got = append(got, eq.Location)
+	}
+	// Scores are 3.5-1/12, 4.5-2 and 5.0-4.
+	want := []string{"recent", "day old", "old strong"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortEarthquakes() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderNoTrailingNewline(t *testing.T) {
+	eqs := []Earthquake{{Location: "IZMIR BAYRAKLI-IZMIR", Magnitude: 4.6, Depth: 12.3}}
+	tests := []struct {
+		noTrailingNewline bool
+		eqs               []Earthquake
+		want              string
+	}{
+		{false, nil, "No important earthquakes recently\n"},
+		{true, nil, "No important earthquakes recently"},
+		{false, eqs, "IZMIR BAYRAKLI-IZMIR\t4.6M\t12.3km\t0001-01-01 00:00:00\n"},
+		{true, eqs, "IZMIR BAYRAKLI-IZMIR\t4.6M\t12.3km\t0001-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		cfg := Config{DepthUnit: depthUnitKm, NoTrailingNewline: tt.noTrailingNewline}
+		if got := string(render(cfg, formatText, tt.eqs)); got != tt.want {
+			t.Errorf("render(NoTrailingNewline=%t) = %q, want %q", tt.noTrailingNewline, got, tt.want)
+		}
+	}
+}
+
+func TestComparedMagnitude(t *testing.T) {
+	tests := []struct {
+		round string
+		mag   float32
+		want  bool
+	}{
+		{magnitudeRoundNearest, 4.5, false},
+		{magnitudeRoundNearest, 4.6, true},
+		{magnitudeRoundUp, 4.5, true},
+		{magnitudeRoundDown, 4.6, true},
+		{magnitudeRoundDown, 4.5, false},
+	}
+	for _, tt := range tests {
+		cfg := Config{MinMagnitude: 4.5, MaxDepth: 60, MagnitudeRound: tt.round}
+		if got := isImportant(cfg, Earthquake{Magnitude: tt.mag, Depth: 10}); got != tt.want {
+			t.Errorf("isImportant(%s, %.1f) = %t, want %t", tt.round, tt.mag, got, tt.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{4}, 90, 4},
+		{[]float64{1, 2, 3, 4, 5}, 0, 1},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{5, 1, 4, 2, 3}, 100, 5},
+		{[]float64{1, 2, 3, 4, 5}, 90, 4.6},
+		{[]float64{2, 4}, 25, 2.5},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %g) = %g, want %g", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestKOERIErrorPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<html><body><h1>Service Unavailable</h1></body></html>")
+	}))
+	defer srv.Close()
+	_, err := KOERISource{URL: srv.URL}.GetEarthquakes(context.Background(), Config{})
+	if !errors.Is(err, errUnexpectedPage) {
+		t.Errorf("GetEarthquakes() error = %v, want %v", err, errUnexpectedPage)
+	}
+	if code := exitCode(err); code != exitServer {
+		t.Errorf("exitCode() = %d, want %d", code, exitServer)
+	}
+}
+
+func TestLooksLikeErrorPage(t *testing.T) {
+	tests := []struct {
+		page string
+		want bool
+	}{
+		{"<HTML><body>Runtime Error</body></HTML>", true},
+		{"<html><body><pre>\n</pre></body></html>", false},
+		{"plain text", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeErrorPage(tt.page); got != tt.want {
+			t.Errorf("looksLikeErrorPage(%q) = %t, want %t", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{
+			"aligned",
+			"2023.02.13 11:38:48  38.0820   37.5890        5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel",
+			false,
+		},
+		{
+			"shifted latitude",
+			"2023.02.13 11:38:48   38.0820   37.5890        5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel",
+			true,
+		},
+		{
+			"shifted longitude",
+			"2023.02.13 11:38:48  38.0820    37.5890       5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel",
+			true,
+		},
+		{"no match", "not an earthquake", true},
+	}
+	for _, tt := range tests {
+		if err := checkColumns(tt.line); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkColumns() error = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPrintNagios(t *testing.T) {
+	cfg := Config{WarningCount: 2, CriticalCount: 4}
+	tests := []struct {
+		count      int
+		err        error
+		wantStatus int
+		wantLine   string
+	}{
+		{2, nil, nagiosOK, "OK: 2 significant earthquakes | count=2;2;4\n"},
+		{3, nil, nagiosWarning, "WARNING: 3 significant earthquakes | count=3;2;4\n"},
+		{4, nil, nagiosWarning, "WARNING: 4 significant earthquakes | count=4;2;4\n"},
+		{5, nil, nagiosCritical, "CRITICAL: 5 significant earthquakes | count=5;2;4\n"},
+		{0, errors.New("connection refused"), nagiosUnknown, "UNKNOWN: connection refused\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		status := printNagios(&buf, cfg, make([]Earthquake, tt.count), tt.err)
+		if status != tt.wantStatus || buf.String() != tt.wantLine {
+			t.Errorf("printNagios(%d earthquakes) = %d, %q, want %d, %q", tt.count, status, buf.String(), tt.wantStatus, tt.wantLine)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2023, 2, 13, hour, 0, 0, 0, time.UTC) }
+	eqs := []Earthquake{
+		{Location: "SIMAV KAYI-SIMAV", Province: "KUTAHYA", Magnitude: 4.0, Depth: 12, Time: at(3)},
+		{Location: " KUCUKKOY-", Province: "ANKARA", Magnitude: 5.1, Depth: 7, Time: at(5)},
+		{Location: "SIMAV NAHIYE-SIMAV", Province: "KUTAHYA", Magnitude: 3.0, Depth: 9, Time: at(1)},
+	}
+	want := Summary{
+		Count:        3,
+		MaxMagnitude: 5.1,
+		MinDepth:     7,
+		NewestTime:   at(5),
+		Regions:      []string{"KUTAHYA", "ANKARA"},
+	}
+	if got := summarize(eqs); !reflect.DeepEqual(got, want) {
+		t.Errorf("summarize() = %+v, want %+v", got, want)
+	}
+	if got := summarize(nil); !reflect.DeepEqual(got, Summary{Regions: []string{}}) {
+		t.Errorf("summarize(nil) = %+v, want zero fields and no regions", got)
+	}
+	out := render(Config{SummaryJSON: true, DepthUnit: depthUnitM}, formatText, eqs)
+	if want := `"minDepth":7000,"depthUnit":"m"`; !bytes.Contains(out, []byte(want)) {
+		t.Errorf("render() = %s, want it to contain %s", out, want)
+	}
+}
+
+func TestParseLineProvince(t *testing.T) {
+	tests := []struct {
+		line     string
+		province string
+		regions  []string
+		want     bool
+	}{
+		{
+			"2023.02.13 11:38:48  37.0820   37.3890        5.0      -.-  4.8  -.-   SOFALACA-SEHITKAMIL (GAZIANTEP)                   Ilksel",
+			"GAZIANTEP",
+			[]string{"gaziantep"},
+			true,
+		},
+		{
+			"2023.02.13 11:20:02  39.2115   32.8533        7.2      -.-  4.1  -.-   KUCUKKOY- (ANKARA)                                Ilksel",
+			"ANKARA",
+			[]string{"IZMIR", "ANKARA"},
+			true,
+		},
+		{
+			"2023.02.13 11:10:02  39.1115   29.3533        7.2      -.-  4.6  -.-   KAYI-SIMAV (KUTAHYA)                              Ilksel",
+			"KUTAHYA",
+			[]string{"IZMIR", "MANISA"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		eq, err := parseLine(tt.line)
+		if err != nil {
+			t.Fatalf("parseLine(%q) error = %v", tt.line, err)
+		}
+		if eq.Province != tt.province {
+			t.Errorf("parseLine(%q).Province = %q, want %q", tt.line, eq.Province, tt.province)
+		}
+		if got := inAnyPlace(eq, tt.regions); got != tt.want {
+			t.Errorf("inAnyPlace(%q, %q) = %t, want %t", eq.Location, tt.regions, got, tt.want)
+		}
+	}
+}
+
+// staticSource is a source that returns its earthquakes.
+type staticSource []Earthquake
+
+func (s staticSource) GetEarthquakes(ctx context.Context, cfg Config) ([]Earthquake, error) {
+	return s, nil
+}
+
+func TestRegionFilters(t *testing.T) {
+	sources["static"] = staticSource{
+		{Location: "SEHITKAMIL SOFALACA-SEHITKAMIL", Province: "GAZIANTEP"},
+		{Location: "NURDAGI NURDAGI-GAZIANTEP", Province: "GAZIANTEP"},
+		{Location: "BAYRAKLI BAYRAKLI-IZMIR", Province: "IZMIR"},
+		{Location: "SIMAV KAYI-SIMAV", Province: "KUTAHYA"},
+	}
+	defer delete(sources, "static")
+	tests := []struct {
+		regions, exclude []string
+		want             []string
+	}{
+		{[]string{"gaziantep", "izmir"}, nil, []string{"SEHITKAMIL SOFALACA-SEHITKAMIL", "NURDAGI NURDAGI-GAZIANTEP", "BAYRAKLI BAYRAKLI-IZMIR"}},
+		{nil, []string{"GAZIANTEP"}, []string{"BAYRAKLI BAYRAKLI-IZMIR", "SIMAV KAYI-SIMAV"}},
+		{[]string{"GAZIANTEP"}, []string{"NURDAGI"}, []string{"SEHITKAMIL SOFALACA-SEHITKAMIL"}},
+		{[]string{"IZMIR"}, []string{"IZMIR"}, nil},
+	}
+	for _, tt := range tests {
+		cfg := Config{Source: "static", All: true, Regions: tt.regions, ExcludeRegions: tt.exclude}
+		eqs, err := getEarthquakes(context.Background(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, eq := range eqs {
+			got = append(got, eq.Location)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("regions=%q exclude=%q: got %q, want %q", tt.regions, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestMapLink(t *testing.T) {
+	eq := Earthquake{Latitude: 38.08203, Longitude: 37.589}
+	url := "https://www.openstreetmap.org/?mlat=38.0820&mlon=37.5890#map=10/38.0820/37.5890"
+	tests := []struct {
+		hyperlinks bool
+		want       string
+	}{
+		{false, url},
+		{true, "\x1b]8;;" + url + "\x1b\\map\x1b]8;;\x1b\\"},
+	}
+	for _, tt := range tests {
+		if got := mapLink(Config{Hyperlinks: tt.hyperlinks}, eq); got != tt.want {
+			t.Errorf("mapLink(hyperlinks=%t) = %q, want %q", tt.hyperlinks, got, tt.want)
+		}
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	eqs := func() []Earthquake {
+		var eqs []Earthquake
+		for _, loc := range []string{"A", "B", "C", "D", "E"} {
+			eqs = append(eqs, Earthquake{Location: loc})
+		}
+		return eqs
+	}
+	tests := []struct {
+		head, tail   int
+		want         string
+		wantElidedAt int
+	}{
+		{0, 0, "ABCDE", 0},
+		{2, 0, "AB", 0},
+		{9, 0, "ABCDE", 0},
+		{0, 2, "DE", 0},
+		{0, 9, "ABCDE", 0},
+		{1, 2, "ADE", 1},
+		{3, 2, "ABCDE", 0},
+	}
+	for _, tt := range tests {
+		got, elidedAt := headTail(Config{Head: tt.head, Tail: tt.tail}, eqs())
+		var locs string
+		for _, eq := range got {
+			locs += eq.Location
+		}
+		if locs != tt.want || elidedAt != tt.wantElidedAt {
+			t.Errorf(
+				"headTail(head=%d, tail=%d) = %s, %d, want %s, %d",
+				tt.head, tt.tail, locs, elidedAt, tt.want, tt.wantElidedAt,
+			)
+		}
+	}
+}
+
+func TestCheckCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		wantErr  bool
+	}{
+		{"Kahramanmaraş", 37.58, 36.93, false},
+		{"Crete", 35.24, 24.81, false},
+		// Swaps inside the bounding box are not detected.
+		{"swapped Kahramanmaraş", 36.93, 37.58, false},
+		{"swapped Izmir", 27.14, 38.42, true},
+		{"Athens", 37.98, 23.73, true},
+		{"Tehran", 35.69, 51.39, true},
+		{"zero", 0, 0, true},
+	}
+	for _, tt := range tests {
+		err := checkCoordinates(Earthquake{Latitude: tt.lat, Longitude: tt.lon})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkCoordinates(%s) error = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestColorizeDepth(t *testing.T) {
+	tests := []struct {
+		depth float32
+		want  string
+	}{
+		{5, "\x1b[31m5.0km\x1b[0m"},
+		{12.3, "\x1b[33m12.3km\x1b[0m"},
+		{45, "\x1b[36m45.0km\x1b[0m"},
+		{102, "\x1b[34m102.0km\x1b[0m"},
+	}
+	cfg := Config{DepthUnit: depthUnitKm, ColorDepth: true}
+	for _, tt := range tests {
+		s := formatDepth(cfg, tt.depth) + cfg.DepthUnit
+		if got := colorizeDepth(cfg, tt.depth, s); got != tt.want {
+			t.Errorf("colorizeDepth(%g) = %q, want %q", tt.depth, got, tt.want)
+		}
+	}
+	if got := colorizeDepth(Config{}, 5, "5.0km"); got != "5.0km" {
+		t.Errorf("colorizeDepth() without -color-depth = %q, want it unchanged", got)
+	}
+}
+
+func TestPrintParsedLine(t *testing.T) {
+	cfg := Config{DepthUnit: depthUnitKm, CoordPrecision: 4}
+	tests := []struct {
+		line     string
+		wantCode int
+		wantKey  string
+	}{
+		{
+			"2023.02.13 11:38:48  38.0820   37.5890        5.0      -.-  4.8  -.-   GOKSUN-KAHRAMANMARAS (KAHRAMANMARAS)              Ilksel",
+			exitOK,
+			"magnitude",
+		},
+		{"2023.02.13 11:38:48 garbage", exitParse, "error"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := printParsedLine(&out, cfg, tt.line); code != tt.wantCode {
+			t.Errorf("printParsedLine(%q) = %d, want %d", tt.line, code, tt.wantCode)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("printParsedLine(%q) printed invalid JSON %q: %v", tt.line, out.String(), err)
+		}
+		if _, ok := got[tt.wantKey]; !ok {
+			t.Errorf("printParsedLine(%q) = %s, want a %q key", tt.line, out.String(), tt.wantKey)
+		}
+	}
+}
+
+func TestUnknownDepthPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		depth  float32
+		want   bool
+	}{
+		{unknownDepthShallow, 0, true},
+		{unknownDepthDeep, 0, false},
+		{unknownDepthExclude, 0, false},
+		{unknownDepthDeep, 5, true},
+		{unknownDepthExclude, 5, true},
+	}
+	for _, tt := range tests {
+		cfg := Config{MinMagnitude: 4, MaxDepth: 60, UnknownDepthPolicy: tt.policy}
+		if got := isImportant(cfg, Earthquake{Magnitude: 5, Depth: tt.depth}); got != tt.want {
+			t.Errorf("isImportant(%s, depth=%g) = %t, want %t", tt.policy, tt.depth, got, tt.want)
+		}
+	}
+	// Deep compares 0.0 as deeper than any band, an unlimited one included.
+	matrix := []DepthBand{{30, 4}, {float32(math.Inf(1)), 4}}
+	for policy, want := range map[string]bool{
+		unknownDepthShallow: true,
+		unknownDepthDeep:    false,
+		unknownDepthExclude: false,
+	} {
+		cfg := Config{Matrix: matrix, UnknownDepthPolicy: policy}
+		if got := isImportant(cfg, Earthquake{Magnitude: 5}); got != want {
+			t.Errorf("isImportant(%s, matrix) = %t, want %t", policy, got, want)
+		}
+	}
+}
+
+func TestParseMatrix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []DepthBand
+		wantErr bool
+	}{
+		{"30:3.5,70:4.5", []DepthBand{{30, 3.5}, {70, 4.5}}, false},
+		{"30:3.5\n inf:5", []DepthBand{{30, 3.5}, {float32(math.Inf(1)), 5}}, false},
+		{"", nil, true},
+		{"30", nil, true},
+		{"0:3", nil, true},
+		{"nan:3", nil, true},
+		{"30:nan", nil, true},
+		{"30:inf", nil, true},
+		{"70:4,30:3", nil, true},
+		{"30:3,30:4", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMatrix(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMatrix(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMatrix(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMatrixMatches(t *testing.T) {
+	cfg := Config{Matrix: []DepthBand{{30, 3.5}, {70, 5}}}
+	tests := []struct {
+		depth, mag float32
+		want       bool
+	}{
+		{10, 3.6, true},
+		{10, 3.5, false},
+		{50, 4.9, false},
+		{50, 5.1, true},
+		{100, 7, false},
+	}
+	for _, tt := range tests {
+		eq := Earthquake{Depth: tt.depth, Magnitude: tt.mag}
+		if got := isImportant(cfg, eq); got != tt.want {
+			t.Errorf("isImportant(depth=%g, mag=%g) = %t, want %t", tt.depth, tt.mag, got, tt.want)
+		}
+	}
+	if got := lowestMinMagnitude(cfg); got != 3.5 {
+		t.Errorf("lowestMinMagnitude() = %g, want 3.5", got)
+	}
+}
+
+func TestUniqueRegions(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2023, 2, 13, hour, 0, 0, 0, time.UTC) }
+	eqs := []Earthquake{
+		{Location: "SIMAV KAYI-SIMAV", Province: "KUTAHYA", Magnitude: 4.0, Time: at(3)},
+		{Location: " KUCUKKOY-", Province: "ANKARA", Magnitude: 3.0, Time: at(2)},
+		{Location: "SIMAV NAHIYE-SIMAV", Province: "KUTAHYA", Magnitude: 5.0, Time: at(1)},
+		{Location: " YENIKOY-", Province: "BURSA", Magnitude: 3.5, Time: at(0)},
+	}
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{uniqueByTime, []string{"SIMAV KAYI-SIMAV", " KUCUKKOY-", " YENIKOY-"}},
+		{uniqueByMagnitude, []string{"SIMAV NAHIYE-SIMAV", " KUCUKKOY-", " YENIKOY-"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, eq := range uniqueRegions(eqs, tt.by) {
+			got = append(got, eq.Location)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueRegions(%s) = %q, want %q", tt.by, got, tt.want)
+		}
+	}
+}
+
+func TestTopRegions(t *testing.T) {
+	eqs := []Earthquake{
+		{Location: "SEHITKAMIL SOFALACA-SEHITKAMIL", Province: "GAZIANTEP"},
+		{Location: "SIMAV KAYI-SIMAV", Province: "KUTAHYA"},
+		{Location: " KUCUKKOY-", Province: "ANKARA"},
+		{Location: "SIMAV NAHIYE-SIMAV", Province: "KUTAHYA"},
+	}
+	var got []string
+	for _, eq := range topRegions(eqs, 2) {
+		got = append(got, eq.Province)
+	}
+	want := []string{"GAZIANTEP", "KUTAHYA", "KUTAHYA"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topRegions(2) provinces = %q, want %q", got, want)
+	}
+}
+
+func TestMagnitudeEmoji(t *testing.T) {
+	tests := []struct {
+		mag  float32
+		want string
+	}{
+		{2.9, "🟢"},
+		{3.0, "🟡"},
+		{4.5, "🟠"},
+		{5.0, "🔴"},
+		{7.8, "🔴"},
+	}
+	for _, tt := range tests {
+		if got := magnitudeEmoji(tt.mag); got != tt.want {
+			t.Errorf("magnitudeEmoji(%.1f) = %s, want %s", tt.mag, got, tt.want)
+		}
+	}
+}
+
+func TestCoordDecimals(t *testing.T) {
+	tests := []struct {
+		lat, lon string
+		want     int
+	}{
+		{"38.0820", "37.5890", 4},
+		{"38.1", "37.5890", 1},
+		{"38.08", "37", 0},
+	}
+	for _, tt := range tests {
+		if got := coordDecimals(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("coordDecimals(%s, %s) = %d, want %d", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+	eq, err := parseLine("2023.02.13 11:20:02  37.2      36.8           7.2      -.-  2.1  -.-   NURDAGI-GAZIANTEP (GAZIANTEP)                     Ilksel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq.coordDecimals != 1 {
+		t.Errorf("parseLine() coordDecimals = %d, want 1", eq.coordDecimals)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"mime"
+	"regexp"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var metaCharsetRegex = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?([\w-]+)`)
+
+// detectEncoding returns the encoding named by the charset of the Content-Type
+// header or, failing that, by the meta tag of the page. It falls back to UTF-8.
+func detectEncoding(contentType, body string) encoding.Encoding {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if enc, err := htmlindex.Get(params["charset"]); err == nil {
+			return enc
+		}
+	}
+	if matches := metaCharsetRegex.FindStringSubmatch(body); matches != nil {
+		if enc, err := htmlindex.Get(matches[1]); err == nil {
+			return enc
+		}
+	}
+	return unicode.UTF8
+}
+
+// decodePage converts the page to UTF-8 from its detected encoding.
+func decodePage(contentType, body string) (string, error) {
+	return detectEncoding(contentType, body).NewDecoder().String(body)
+}
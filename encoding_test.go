@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodePage(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		contentType string
+	}{
+		{"iso-8859-9 meta charset", "testdata/koeri-iso-8859-9.html", ""},
+		{"iso-8859-9 header charset", "testdata/koeri-iso-8859-9.html", "text/html; charset=ISO-8859-9"},
+		{"utf-8 meta charset", "testdata/koeri-utf-8.html", ""},
+		{"utf-8 header charset", "testdata/koeri-utf-8.html", "text/html; charset=utf-8"},
+		{"no charset", "testdata/koeri-utf-8.html", "text/html"},
+	}
+	for _, tt := range tests {
+		body, err := os.ReadFile(tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := decodePage(tt.contentType, string(body))
+		if err != nil {
+			t.Fatalf("%s: decodePage() error = %v", tt.name, err)
+		}
+		if want := "GÖKSUN-KAHRAMANMARAŞ (KAHRAMANMARAŞ)"; !strings.Contains(page, want) {
+			t.Errorf("%s: decodePage() does not contain %q:\n%s", tt.name, want, page)
+		}
+	}
+}
+
+func TestDetectEncodingHeaderOverridesMeta(t *testing.T) {
+	body, err := os.ReadFile("testdata/koeri-utf-8.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := detectEncoding("text/html; charset=windows-1254", string(body))
+	if got, _ := enc.NewDecoder().String("\xde"); got != "Ş" {
+		t.Errorf("detectEncoding() decodes 0xDE as %q, want Ş from the windows-1254 header", got)
+	}
+}
+
+func TestParseDecodedLines(t *testing.T) {
+	for _, fixture := range []string{"testdata/koeri-iso-8859-9.html", "testdata/koeri-utf-8.html"} {
+		body, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := decodePage("", string(body))
+		if err != nil {
+			t.Fatalf("%s: decodePage() error = %v", fixture, err)
+		}
+		lines := eqLineRegex.FindAllString(page, -1)
+		if len(lines) != 1 {
+			t.Fatalf("%s: %d earthquake lines, want 1", fixture, len(lines))
+		}
+		eq, err := parseLine(lines[0])
+		if err != nil {
+			t.Fatalf("%s: parseLine() error = %v", fixture, err)
+		}
+		if eq.Location != "KAHRAMANMARAŞ GÖKSUN-KAHRAMANMARAŞ" || eq.Province != "KAHRAMANMARAŞ" {
+			t.Errorf("%s: parseLine() location = %q, province = %q", fixture, eq.Location, eq.Province)
+		}
+	}
+}
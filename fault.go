@@ -0,0 +1,98 @@
+package main
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+type LatLon struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Fault is a fault line approximated by a polyline. Events closer to the line
+// than BufferKm are considered to be on the fault zone.
+type Fault struct {
+	Name     string
+	BufferKm float64
+	Line     []LatLon
+}
+
+// faults holds rough traces of the major Anatolian faults. The vertices are
+// taken from well known towns along the fault, so the geometry is only good
+// to a few kilometers and the buffers are wide enough to absorb that.
+var faults = map[string]Fault{
+	"NAF": {
+		Name:     "North Anatolian Fault",
+		BufferKm: 30,
+		Line: []LatLon{
+			{39.29, 41.01}, // Karlıova
+			{39.74, 39.49}, // Erzincan
+			{40.15, 38.08}, // Suşehri
+			{40.59, 36.96}, // Niksar
+			{40.97, 35.66}, // Havza
+			{41.13, 34.49}, // Kargı
+			{40.80, 32.20}, // Gerede
+			{40.84, 31.16}, // Düzce
+			{40.69, 30.27}, // Sapanca
+			{40.76, 29.92}, // İzmit
+			{40.80, 28.50}, // Marmara Sea
+			{40.60, 26.90}, // Saros Gulf
+		},
+	},
+	"EAF": {
+		Name:     "East Anatolian Fault",
+		BufferKm: 30,
+		Line: []LatLon{
+			{39.29, 41.01}, // Karlıova
+			{38.88, 40.50}, // Bingöl
+			{38.69, 39.93}, // Palu
+			{38.45, 39.31}, // Sivrice
+			{38.20, 38.87}, // Pütürge
+			{38.03, 38.24}, // Çelikhan
+			{37.78, 37.64}, // Gölbaşı
+			{37.38, 36.85}, // Türkoğlu
+			{36.20, 36.16}, // Antakya
+		},
+	},
+}
+
+func (f Fault) Contains(p LatLon) bool {
+	return distanceToPolylineKm(p, f.Line) <= f.BufferKm
+}
+
+func distanceToPolylineKm(p LatLon, line []LatLon) float64 {
+	min := math.Inf(1)
+	for i := 0; i+1 < len(line); i++ {
+		min = math.Min(min, distanceToSegmentKm(p, line[i], line[i+1]))
+	}
+	return min
+}
+
+// distanceToSegmentKm projects the points onto a plane tangent at p, which is
+// accurate enough for the segment lengths used here.
+func distanceToSegmentKm(p, a, b LatLon) float64 {
+	kmPerLon := earthRadiusKm * radians(1) * math.Cos(radians(p.Latitude))
+	kmPerLat := earthRadiusKm * radians(1)
+	ax, ay := (a.Longitude-p.Longitude)*kmPerLon, (a.Latitude-p.Latitude)*kmPerLat
+	bx, by := (b.Longitude-p.Longitude)*kmPerLon, (b.Latitude-p.Latitude)*kmPerLat
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lenSq))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// distanceKm returns the great-circle distance between two points.
+func distanceKm(a, b LatLon) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestFaultContains(t *testing.T) {
+	tests := []struct {
+		fault string
+		name  string
+		point LatLon
+		want  bool
+	}{
+		{"NAF", "İzmit", LatLon{40.76, 29.92}, true},
+		{"NAF", "Adapazarı", LatLon{40.78, 30.40}, true},
+		{"NAF", "Ankara", LatLon{39.93, 32.85}, false},
+		{"NAF", "Antalya", LatLon{36.90, 30.70}, false},
+		{"EAF", "Gölbaşı", LatLon{37.78, 37.64}, true},
+		{"EAF", "Elazığ", LatLon{38.67, 39.22}, true},
+		{"EAF", "İzmit", LatLon{40.76, 29.92}, false},
+	}
+	for _, tt := range tests {
+		if got := faults[tt.fault].Contains(tt.point); got != tt.want {
+			t.Errorf("%s Contains(%s) = %t, want %t", tt.fault, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// İstanbul to Ankara is about 350 km as the crow flies.
+	got := distanceKm(LatLon{41.01, 28.98}, LatLon{39.93, 32.85})
+	if got < 340 || got > 360 {
+		t.Errorf("distanceKm(İstanbul, Ankara) = %.0f, want about 350", got)
+	}
+}
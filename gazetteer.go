@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	langTR = "tr"
+	langEN = "en"
+)
+
+// gazetteer maps the observatory's Turkish place names to other languages,
+// keyed by language and then by the ASCII folded, upper case Turkish name.
+// Names that read the same in the target language are left out. Location names
+// are translated word by word, so common words like DENIZI are listed on their
+// own.
+var gazetteer = map[string]map[string]string{
+	langEN: {
+		"AKDENIZ":     "MEDITERRANEAN SEA",
+		"KARADENIZ":   "BLACK SEA",
+		"EGE":         "AEGEAN",
+		"DENIZI":      "SEA",
+		"KORFEZI":     "GULF",
+		"BOGAZI":      "STRAIT",
+		"ADASI":       "ISLAND",
+		"ADALARI":     "ISLANDS",
+		"GOLU":        "LAKE",
+		"BARAJI":      "DAM",
+		"KIBRIS":      "CYPRUS",
+		"YUNANISTAN":  "GREECE",
+		"BULGARISTAN": "BULGARIA",
+		"GURCISTAN":   "GEORGIA",
+		"ERMENISTAN":  "ARMENIA",
+		"AZERBAYCAN":  "AZERBAIJAN",
+		"NAHCIVAN":    "NAKHCHIVAN",
+		"IRAK":        "IRAQ",
+		"SURIYE":      "SYRIA",
+		"LUBNAN":      "LEBANON",
+		"MISIR":       "EGYPT",
+		"GIRIT":       "CRETE",
+		"ONIKI":       "DODECANESE",
+	},
+}
+
+var placeWordRegex = regexp.MustCompile(`[^\s\-()]+`)
+
+var turkishFolder = strings.NewReplacer(
+	"İ", "I", "ı", "i", "Ş", "S", "ş", "s", "Ğ", "G", "ğ", "g",
+	"Ü", "U", "ü", "u", "Ö", "O", "ö", "o", "Ç", "C", "ç", "c",
+)
+
+// foldTurkish replaces Turkish specific letters with their ASCII counterparts
+// and upper cases the result, so that İZMİR and IZMIR compare equal.
+func foldTurkish(s string) string {
+	return strings.ToUpper(turkishFolder.Replace(s))
+}
+
+// translateLocation translates the known words of a location to the given
+// language, keeping unknown words and separators as they are.
+func translateLocation(lang, location string) string {
+	names, ok := gazetteer[lang]
+	if !ok {
+		return location
+	}
+	return placeWordRegex.ReplaceAllStringFunc(location, func(word string) string {
+		if name, ok := names[foldTurkish(word)]; ok {
+			return name
+		}
+		return word
+	})
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatText  = "text"
+	formatTSV   = "tsv"
+	formatJSONL = "jsonl"
+	// formatRegionJSONL prints a JSON array of the earthquakes of each region
+	// per line.
+	formatRegionJSONL = "region-jsonl"
+	formatRSS         = "rss"
+)
+
+var formats = []string{formatText, formatTSV, formatJSONL, formatRegionJSONL, formatRSS}
+
+// outputDialTimeout is how long connecting to a tcp:// output may take.
+const outputDialTimeout = 10 * time.Second
+
+var formatsByExtension = map[string]string{
+	".txt":    formatText,
+	".tsv":    formatTSV,
+	".jsonl":  formatJSONL,
+	".ndjson": formatJSONL,
+	".rss":    formatRSS,
+}
+
+// Destination is a place to write the output to, in a format of its own.
+type Destination struct {
+	Target string
+	Format string
+}
+
+// parseDestination parses an -output value, which is a target optionally
+// followed by :format. Without an explicit format, it is inferred from the
+// file extension, ignoring a trailing .gz, or defaultFormat is used.
+func parseDestination(value, defaultFormat string) Destination {
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		if format := value[i+1:]; isFormat(format) {
+			return Destination{Target: value[:i], Format: format}
+		}
+	}
+	ext := filepath.Ext(strings.TrimSuffix(value, ".gz"))
+	if format, ok := formatsByExtension[ext]; ok && !strings.HasPrefix(value, "tcp://") {
+		return Destination{Target: value, Format: format}
+	}
+	return Destination{Target: value, Format: defaultFormat}
+}
+
+func writesToStdout(destinations []Destination) bool {
+	for _, dest := range destinations {
+		if dest.Target == "-" || dest.Target == "stdout" {
+			return true
+		}
+	}
+	return false
+}
+
+func isFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutputs renders the earthquakes once per format and writes them to
+// every destination of that format.
+func writeOutputs(ctx context.Context, cfg Config, eqs []Earthquake) error {
+	// Destinations of the same format differ when only some are terminals.
+	type renderKey struct {
+		format     string
+		colorDepth bool
+		emoji      bool
+	}
+	var keys []renderKey
+	configs := map[renderKey]Config{}
+	targets := map[renderKey][]string{}
+	for _, dest := range cfg.Outputs {
+		destCfg := forTarget(cfg, dest.Target)
+		key := renderKey{format: dest.Format, colorDepth: destCfg.ColorDepth, emoji: destCfg.Emoji}
+		if _, ok := targets[key]; !ok {
+			keys = append(keys, key)
+			configs[key] = destCfg
+		}
+		targets[key] = append(targets[key], dest.Target)
+	}
+	for _, key := range keys {
+		if err := writeToAll(ctx, targets[key], render(configs[key], key.format, eqs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forTarget returns the config to render the output of the target with,
+// keeping the terminal only decorations for targets that are terminals.
+func forTarget(cfg Config, target string) Config {
+	var f *os.File
+	switch target {
+	case "-", "stdout":
+		f = os.Stdout
+	case "stderr":
+		f = os.Stderr
+	}
+	if f == nil || !isTerminal(f) {
+		return withoutDecorations(cfg)
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		cfg.ColorDepth = false
+	}
+	return cfg
+}
+
+// withoutDecorations turns off the colors and emoji meant for terminals.
+func withoutDecorations(cfg Config) Config {
+	cfg.ColorDepth = false
+	cfg.Emoji = false
+	return cfg
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeToAll writes the data to every target. If any target fails, the files
+// are left as they were and the temporary files are removed.
+func writeToAll(ctx context.Context, targets []string, data []byte) error {
+	var writers []io.WriteCloser
+	abortAll := func() {
+		for _, w := range writers {
+			if f, ok := w.(*atomicFile); ok {
+				f.Abort()
+			} else {
+				w.Close()
+			}
+		}
+	}
+	for _, target := range targets {
+		w, err := openDestination(ctx, target)
+		if err != nil {
+			abortAll()
+			return err
+		}
+		writers = append(writers, w)
+	}
+	for _, w := range writers {
+		if _, err := w.Write(data); err != nil {
+			abortAll()
+			return fmt.Errorf("error while writing output: %w", err)
+		}
+	}
+	var firstErr error
+	for _, w := range writers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func render(cfg Config, format string, eqs []Earthquake) []byte {
+	var out bytes.Buffer
+	switch {
+	case cfg.CountOnly:
+		fmt.Fprintf(&out, "%s%d\n", cfg.Label, len(eqs))
+	case cfg.SummaryJSON:
+		summary := summarize(eqs)
+		summary.MinDepth = depthInUnit(cfg, summary.MinDepth)
+		summary.DepthUnit = cfg.DepthUnit
+		json.NewEncoder(&out).Encode(summary)
+	case format == formatText && cfg.Accessible:
+		printAccessible(&out, cfg, eqs)
+	case format == formatTSV:
+		printTSV(&out, cfg, eqs)
+	case format == formatJSONL:
+		printJSONL(&out, cfg, eqs)
+	case format == formatRegionJSONL:
+		printRegionJSONL(&out, cfg, eqs)
+	case format == formatRSS:
+		printRSS(&out, cfg, eqs)
+	default:
+		printEarthquakes(&out, cfg, eqs)
+	}
+	if cfg.Footer && format == formatText && !cfg.CountOnly && !cfg.SummaryJSON {
+		printFooter(&out, cfg, eqs)
+	}
+	data := out.Bytes()
+	if cfg.NoTrailingNewline {
+		data = bytes.TrimSuffix(data, []byte("\n"))
+	}
+	return data
+}
+
+// printFooter prints when the earthquakes were fetched and the time of the
+// newest one, for -footer.
+func printFooter(w io.Writer, cfg Config, eqs []Earthquake) {
+	if len(eqs) == 0 {
+		fmt.Fprintf(w, "Fetched %s, no earthquakes\n", cfg.fetchedAt.Format("15:04"))
+		return
+	}
+	newest := eqs[0].Time
+	for _, eq := range eqs[1:] {
+		if eq.Time.After(newest) {
+			newest = eq.Time
+		}
+	}
+	fmt.Fprintf(w, "Fetched %s, newest event %s\n", cfg.fetchedAt.Format("15:04"), newest.Format("15:04"))
+}
+
+// printAccessible prints a sentence per earthquake, without colors or
+// alignment, for screen readers.
+func printAccessible(w io.Writer, cfg Config, eqs []Earthquake) {
+	if len(eqs) == 0 {
+		fmt.Fprintln(w, "No important earthquakes recently.")
+		return
+	}
+	now := timeNow()
+	for _, eq := range eqs {
+		fmt.Fprintf(
+			w,
+			"Magnitude %.1f, depth %s %s, near %s, %s ago.\n",
+			eq.Magnitude,
+			formatDepth(cfg, eq.Depth),
+			cfg.DepthUnit,
+			eq.Location,
+			humanizeDurationWords(now.Sub(eq.Time)),
+		)
+	}
+}
+
+// printJSONL prints every earthquake as a JSON object on its own line.
+func printJSONL(w io.Writer, cfg Config, eqs []Earthquake) {
+	enc := json.NewEncoder(w)
+	for _, eq := range eqs {
+		enc.Encode(jsonEarthquake(cfg, eq))
+	}
+}
+
+// maxCoordPrecision is the most decimal places of -coord-precision, about a
+// millimeter on the ground.
+const maxCoordPrecision = 8
+
+// jsonEarthquake returns the earthquake to encode as JSON, with its depth in
+// DepthUnit, its coordinates rounded to CoordPrecision decimals and its
+// numbers as strings when JSONNumbersAsStrings is set.
+func jsonEarthquake(cfg Config, eq Earthquake) any {
+	eq.Latitude = roundCoord(eq.Latitude, cfg.CoordPrecision)
+	eq.Longitude = roundCoord(eq.Longitude, cfg.CoordPrecision)
+	if cfg.JSONNumbersAsStrings {
+		return stringNumbersEarthquake{
+			eq:             eq,
+			coordPrecision: cfg.CoordPrecision,
+			depth:          formatDepth(cfg, eq.Depth),
+			depthUnit:      cfg.DepthUnit,
+		}
+	}
+	eq.Depth = depthInUnit(cfg, eq.Depth)
+	return unitEarthquake{Earthquake: eq, DepthUnit: cfg.DepthUnit}
+}
+
+// unitEarthquake is an earthquake encoded with the unit of its depth.
+type unitEarthquake struct {
+	Earthquake
+	DepthUnit string `json:"depth_unit"`
+}
+
+func roundCoord(coord float64, precision int) float64 {
+	scale := math.Pow10(precision)
+	return math.Round(coord*scale) / scale
+}
+
+// stringNumbersEarthquake is an earthquake encoded with its numbers as fixed
+// precision strings, for JSON consumers that parse numbers as floats.
+type stringNumbersEarthquake struct {
+	eq             Earthquake
+	coordPrecision int
+	// depth is formatted in depthUnit.
+	depth     string
+	depthUnit string
+}
+
+func (s stringNumbersEarthquake) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Location  string    `json:"location"`
+		Province  string    `json:"province"`
+		Latitude  string    `json:"latitude"`
+		Longitude string    `json:"longitude"`
+		Time      time.Time `json:"time"`
+		Magnitude string    `json:"magnitude"`
+		Depth     string    `json:"depth"`
+		DepthUnit string    `json:"depth_unit"`
+	}{
+		Location:  s.eq.Location,
+		Province:  s.eq.Province,
+		Latitude:  strconv.FormatFloat(s.eq.Latitude, 'f', s.coordPrecision, 64),
+		Longitude: strconv.FormatFloat(s.eq.Longitude, 'f', s.coordPrecision, 64),
+		Time:      s.eq.Time,
+		Magnitude: strconv.FormatFloat(float64(s.eq.Magnitude), 'f', 1, 32),
+		Depth:     s.depth,
+		DepthUnit: s.depthUnit,
+	})
+}
+
+// printRegionJSONL prints the earthquakes of every region as a compact JSON
+// array on its own line, regions in the order they first appear.
+func printRegionJSONL(w io.Writer, cfg Config, eqs []Earthquake) {
+	var regions []string
+	byRegion := map[string][]any{}
+	for _, eq := range eqs {
+		region := eq.Region()
+		if _, ok := byRegion[region]; !ok {
+			regions = append(regions, region)
+		}
+		byRegion[region] = append(byRegion[region], jsonEarthquake(cfg, eq))
+	}
+	enc := json.NewEncoder(w)
+	for _, region := range regions {
+		enc.Encode(byRegion[region])
+	}
+}
+
+// validateDestination checks a target without opening it, so that mistakes are
+// reported before fetching anything.
+func validateDestination(target string) error {
+	switch {
+	case target == "-", target == "stdout", target == "stderr", target == "null":
+		return nil
+	case strings.HasPrefix(target, "tcp://"):
+		if _, _, err := net.SplitHostPort(strings.TrimPrefix(target, "tcp://")); err != nil {
+			return fmt.Errorf("invalid tcp output, target=%s: %w", target, err)
+		}
+		return nil
+	default:
+		dir := filepath.Dir(target)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("invalid output file, path=%s: %w", target, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid output file, path=%s: %s is not a directory", target, dir)
+		}
+		return nil
+	}
+}
+
+// openDestination opens - and stdout as stdout, stderr as stderr, null as a
+// writer that discards everything, tcp://host:port as a TCP connection and
+// anything else as a file. Connecting gives up after outputDialTimeout or when
+// the context is done.
+func openDestination(ctx context.Context, target string) (io.WriteCloser, error) {
+	switch {
+	case target == "-", target == "stdout":
+		return nopWriteCloser{os.Stdout}, nil
+	case target == "stderr":
+		return nopWriteCloser{os.Stderr}, nil
+	case target == "null":
+		return nopWriteCloser{io.Discard}, nil
+	case strings.HasPrefix(target, "tcp://"):
+		dialer := net.Dialer{Timeout: outputDialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", strings.TrimPrefix(target, "tcp://"))
+		if err != nil {
+			return nil, fmt.Errorf("error while connecting to output, target=%s: %w", target, err)
+		}
+		return conn, nil
+	default:
+		return createAtomicFile(target)
+	}
+}
+
+// pipeTo runs the command with sh and writes data to its stdin. The command
+// shares stdout and stderr with dprm.
+func pipeTo(command string, data []byte) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error while running pipe command, command=%s: %w", command, err)
+	}
+	return nil
+}
+
+// atomicFile writes to a temporary file next to path and renames it over path
+// on Close, so readers never see a partially written file. os.Rename uses
+// MoveFileEx with MOVEFILE_REPLACE_EXISTING on Windows, which replaces the
+// target as well. Paths ending with .gz are gzip compressed.
+type atomicFile struct {
+	path string
+	tmp  *os.File
+	w    io.WriteCloser
+	err  error
+}
+
+func createAtomicFile(path string) (*atomicFile, error) {
+	tmp, err := createTempFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating temporary output file, path=%s: %w", path, err)
+	}
+	// The rename keeps the mode of the temporary file, so it takes the mode
+	// of the file it replaces.
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("error while setting mode of temporary output file, path=%s: %w", path, err)
+		}
+	}
+	f := &atomicFile{path: path, tmp: tmp, w: nopWriteCloser{tmp}}
+	if strings.HasSuffix(path, ".gz") {
+		f.w = gzip.NewWriter(tmp)
+	}
+	return f, nil
+}
+
+// createTempFile creates a temporary file next to path. Unlike os.CreateTemp,
+// which uses 0600, it creates the file with 0666 minus the umask, like
+// os.Create does.
+func createTempFile(path string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(
+			filepath.Dir(path),
+			"."+filepath.Base(path)+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp",
+		)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil && f.err == nil {
+		f.err = fmt.Errorf("error while writing output file, path=%s: %w", f.tmp.Name(), err)
+	}
+	return n, err
+}
+
+// Close renames the temporary file over the target, unless a write failed.
+func (f *atomicFile) Close() error {
+	defer os.Remove(f.tmp.Name())
+	if err := f.w.Close(); err != nil && f.err == nil {
+		f.err = fmt.Errorf("error while compressing output file, path=%s: %w", f.tmp.Name(), err)
+	}
+	if err := f.tmp.Close(); err != nil && f.err == nil {
+		f.err = fmt.Errorf("error while closing output file, path=%s: %w", f.tmp.Name(), err)
+	}
+	if f.err != nil {
+		return f.err
+	}
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("error while renaming output file, path=%s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Abort removes the temporary file without touching the target.
+func (f *atomicFile) Abort() {
+	f.w.Close()
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
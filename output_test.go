@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintTSV(t *testing.T) {
+	eqs := []Earthquake{{
+		Location:  "IZMIR\tBAYRAKLI\nIZMIR",
+		Magnitude: 3.6,
+		Depth:     12.3,
+		Time:      time.Date(2023, 2, 13, 10, 55, 17, 0, time.UTC),
+	}}
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{
+			Config{DepthUnit: depthUnitKm},
+			"location\tmagnitude\tdepth_km\ttime\nIZMIR BAYRAKLI IZMIR\t3.6\t12.3\t2023-02-13 10:55:17\n",
+		},
+		{
+			Config{DepthUnit: depthUnitM, NoHeader: true},
+			"IZMIR BAYRAKLI IZMIR\t3.6\t12300\t2023-02-13 10:55:17\n",
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		printTSV(&out, tt.cfg, eqs)
+		if out.String() != tt.want {
+			t.Errorf("printTSV(%+v) = %q, want %q", tt.cfg, out.String(), tt.want)
+		}
+	}
+}
+
+func TestAtomicFileKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	if err := os.WriteFile(path, []byte("old"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeToAll(context.Background(), []string{path}, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o640 {
+		t.Errorf("mode = %o, want %o", got, 0o640)
+	}
+}
+
+func TestWriteToAllKeepsFilesOnError(t *testing.T) {
+	dir := t.TempDir()
+	keep := filepath.Join(dir, "keep.txt")
+	if err := os.WriteFile(keep, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing", "out.txt")
+	if err := writeToAll(context.Background(), []string{keep, missing}, []byte("new")); err == nil {
+		t.Fatal("writeToAll() error = nil, want an error for the missing directory")
+	}
+	got, err := os.ReadFile(keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "old" {
+		t.Errorf("keep.txt = %q, want %q", got, "old")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only keep.txt", len(entries))
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Destination
+	}{
+		{"-", Destination{"-", formatText}},
+		{"out.txt", Destination{"out.txt", formatText}},
+		{"out.tsv", Destination{"out.tsv", formatTSV}},
+		{"out.jsonl.gz", Destination{"out.jsonl.gz", formatJSONL}},
+		{"events.ndjson", Destination{"events.ndjson", formatJSONL}},
+		{"out.log:tsv", Destination{"out.log", formatTSV}},
+		{"out.tsv:jsonl", Destination{"out.tsv", formatJSONL}},
+		{"stderr:region-jsonl", Destination{"stderr", formatRegionJSONL}},
+		{"tcp://localhost:9000", Destination{"tcp://localhost:9000", formatText}},
+		{"tcp://localhost:9000:jsonl", Destination{"tcp://localhost:9000", formatJSONL}},
+		{"C:out", Destination{"C:out", formatText}},
+	}
+	for _, tt := range tests {
+		if got := parseDestination(tt.value, formatText); got != tt.want {
+			t.Errorf("parseDestination(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWriteToAllTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+	target := "tcp://" + ln.Addr().String()
+	if err := writeToAll(context.Background(), []string{target}, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "new" {
+		t.Errorf("received %q, want %q", got, "new")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := openDestination(ctx, target); err == nil {
+		t.Error("openDestination() error = nil, want an error for a done context")
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares the output with testdata/<name>.golden.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// goldenNow is the time the golden earthquakes are shown at.
+var goldenNow = time.Date(2023, 2, 13, 12, 0, 0, 0, time.UTC)
+
+func goldenEarthquakes() []Earthquake {
+	return []Earthquake{
+		{Location: "KAHRAMANMARAS GOKSUN-KAHRAMANMARAS", Magnitude: 4.8, Depth: 5, Time: goldenNow.Add(-21 * time.Minute)},
+		{Location: "GAZIANTEP NURDAGI-GAZIANTEP", Magnitude: 4.5, Depth: 7.2, Time: goldenNow.Add(-40 * time.Minute)},
+		{Location: "IZMIR BAYRAKLI-IZMIR", Magnitude: 4.6, Depth: 12.3, Time: goldenNow.Add(-26 * time.Hour)},
+	}
+}
+
+// withTimeNow makes timeNow return now until the test ends.
+func withTimeNow(t *testing.T, now time.Time) {
+	t.Helper()
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func TestPrintEarthquakesBothTimes(t *testing.T) {
+	withTimeNow(t, goldenNow)
+	var buf bytes.Buffer
+	printEarthquakes(&buf, Config{DepthUnit: depthUnitKm, BothTimes: true}, goldenEarthquakes())
+	checkGolden(t, "both-times", buf.Bytes())
+}
+
+func TestJSONEarthquakeDepthUnit(t *testing.T) {
+	eq := Earthquake{Location: "X", Depth: 8.6}
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{DepthUnit: depthUnitKm, CoordPrecision: 4}, `"depth":8.6,"depth_unit":"km"`},
+		{Config{DepthUnit: depthUnitM, CoordPrecision: 4}, `"depth":8600,"depth_unit":"m"`},
+		{Config{DepthUnit: depthUnitM, CoordPrecision: 4, JSONNumbersAsStrings: true}, `"depth":"8600","depth_unit":"m"`},
+	}
+	for _, tt := range tests {
+		out, err := json.Marshal(jsonEarthquake(tt.cfg, eq))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), tt.want) {
+			t.Errorf("jsonEarthquake(%+v) = %s, want it to contain %s", tt.cfg, out, tt.want)
+		}
+	}
+}
+
+func TestPrintAccessible(t *testing.T) {
+	withTimeNow(t, goldenNow)
+	var buf bytes.Buffer
+	printAccessible(&buf, Config{DepthUnit: depthUnitKm}, goldenEarthquakes())
+	printAccessible(&buf, Config{DepthUnit: depthUnitKm}, nil)
+	checkGolden(t, "accessible", buf.Bytes())
+}
+
+func TestPrintRegionJSONL(t *testing.T) {
+	eqs := []Earthquake{
+		{Location: "SIMAV KAYI-SIMAV", Province: "KUTAHYA"},
+		{Location: " KUCUKKOY-", Province: "ANKARA"},
+		{Location: "SIMAV NAHIYE-SIMAV", Province: "KUTAHYA"},
+	}
+	var out bytes.Buffer
+	printRegionJSONL(&out, Config{DepthUnit: depthUnitKm, CoordPrecision: 4}, eqs)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := [][]string{{"SIMAV KAYI-SIMAV", "SIMAV NAHIYE-SIMAV"}, {" KUCUKKOY-"}}
+	if len(lines) != len(want) {
+		t.Fatalf("printRegionJSONL() printed %d lines, want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i, line := range lines {
+		var region []Earthquake
+		if err := json.Unmarshal([]byte(line), &region); err != nil {
+			t.Fatalf("line %d is not a JSON array: %v", i, err)
+		}
+		var got []string
+		for _, eq := range region {
+			got = append(got, eq.Location)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d locations = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestRenderFooter(t *testing.T) {
+	withTimeNow(t, goldenNow)
+	cfg := Config{DepthUnit: depthUnitKm, Footer: true, fetchedAt: goldenNow}
+	out := render(cfg, formatText, goldenEarthquakes())
+	out = append(out, render(cfg, formatText, nil)...)
+	out = append(out, render(cfg, formatJSONL, goldenEarthquakes()[:1])...)
+	checkGolden(t, "footer", out)
+}
+
+func TestJSONNumbersAsStrings(t *testing.T) {
+	eq := Earthquake{
+		Location:  "X",
+		Latitude:  38.08201,
+		Longitude: 37.5,
+		Magnitude: 4.8,
+		Depth:     5,
+		Time:      time.Date(2023, 2, 13, 8, 38, 48, 0, time.UTC),
+	}
+	cfg := Config{DepthUnit: depthUnitKm, CoordPrecision: 4, JSONNumbersAsStrings: true}
+	out, err := json.Marshal(jsonEarthquake(cfg, eq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"location":   "X",
+		"province":   "",
+		"latitude":   "38.0820",
+		"longitude":  "37.5000",
+		"time":       "2023-02-13T08:38:48Z",
+		"magnitude":  "4.8",
+		"depth":      "5.0",
+		"depth_unit": "km",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonEarthquake() = %s, want %v", out, want)
+	}
+}
+
+func TestWriteOutputsWithoutDecorationsInFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	cfg := Config{
+		DepthUnit:  depthUnitKm,
+		ColorDepth: true,
+		Emoji:      true,
+		Outputs:    []Destination{{Target: path, Format: formatText}},
+	}
+	if err := writeOutputs(context.Background(), cfg, []Earthquake{{Location: "X", Magnitude: 4, Depth: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "\x1b[") {
+		t.Errorf("output file has ANSI escapes: %q", got)
+	}
+	if strings.Contains(string(got), magnitudeEmoji(4)) {
+		t.Errorf("output file has emoji: %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// sourceSites are the web sites of the sources, linked from the feed.
+var sourceSites = map[string]string{
+	"koeri": "http://www.koeri.boun.edu.tr",
+	"afad":  "https://deprem.afad.gov.tr",
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+	GUID        rssGUID `xml:"guid"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// printRSS prints the earthquakes as an RSS 2.0 feed, an item per earthquake.
+func printRSS(w io.Writer, cfg Config, eqs []Earthquake) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Recent earthquakes in Turkey",
+			Link:        sourceSites[cfg.Source],
+			Description: "Earthquakes reported by " + cfg.Source,
+		},
+	}
+	for _, eq := range eqs {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title: fmt.Sprintf("%.1fM %s", eq.Magnitude, eq.Location),
+			Link:  mapURL(eq),
+			Description: fmt.Sprintf(
+				"Magnitude %.1f at a depth of %s %s",
+				eq.Magnitude,
+				formatDepth(cfg, eq.Depth),
+				cfg.DepthUnit,
+			),
+			PubDate: eq.Time.Format(time.RFC1123Z),
+			// The observatory has no event ids, the time and epicenter
+			// identify an earthquake.
+			GUID: rssGUID{Value: fmt.Sprintf(
+				"%s/%.4f/%.4f",
+				eq.Time.UTC().Format(time.RFC3339),
+				eq.Latitude,
+				eq.Longitude,
+			)},
+		})
+	}
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+	io.WriteString(w, "\n")
+}
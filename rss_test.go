@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestPrintRSS(t *testing.T) {
+	eqs := []Earthquake{
+		{Location: "AKDENIZ <MED> & EGE", Latitude: 35.1234, Longitude: 27.5, Magnitude: 4.8, Depth: 5, Time: time.Date(2023, 2, 13, 11, 38, 48, 0, time.UTC)},
+		{Location: "IZMIR BAYRAKLI-IZMIR", Latitude: 38.4512, Longitude: 27.1843, Magnitude: 4.6, Depth: 12.3, Time: time.Date(2023, 2, 13, 10, 55, 17, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	printRSS(&buf, Config{Source: "koeri", DepthUnit: depthUnitKm}, eqs)
+	var feed rssFeed
+	if err := xml.Unmarshal(buf.Bytes(), &feed); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v\n%s", err, buf.String())
+	}
+	if feed.Version != "2.0" || feed.Channel.Link != "http://www.koeri.boun.edu.tr" {
+		t.Errorf("feed version = %q, link = %q", feed.Version, feed.Channel.Link)
+	}
+	if len(feed.Channel.Items) != len(eqs) {
+		t.Fatalf("feed has %d items, want %d", len(feed.Channel.Items), len(eqs))
+	}
+	want := rssItem{
+		Title:       "4.8M AKDENIZ <MED> & EGE",
+		Link:        "https://www.openstreetmap.org/?mlat=35.1234&mlon=27.5000#map=10/35.1234/27.5000",
+		Description: "Magnitude 4.8 at a depth of 5.0 km",
+		PubDate:     "Mon, 13 Feb 2023 11:38:48 +0000",
+		GUID:        rssGUID{Value: "2023-02-13T11:38:48Z/35.1234/27.5000"},
+	}
+	if got := feed.Channel.Items[0]; got != want {
+		t.Errorf("first item = %+v, want %+v", got, want)
+	}
+}
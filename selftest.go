@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const selftestTimeout = 30 * time.Second
+
+// selftest checks that dprm can fetch and parse the observatory list on this
+// machine, printing PASS or FAIL for every check. It returns the exit code.
+func selftest() int {
+	ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+	defer cancel()
+	failed := false
+	check := func(name string, err error) bool {
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", name, err)
+			failed = true
+			return false
+		}
+		fmt.Printf("PASS %s\n", name)
+		return true
+	}
+
+	_, err := time.LoadLocation("Europe/Istanbul")
+	check("timezone data", err)
+
+	page, err := getObservatoryPage(ctx, observatoryURL)
+	if check("fetch observatory page", err) {
+		var lines []string
+		var eqs []Earthquake
+		for _, line := range strings.Split(page, "\n") {
+			if !eqLineRegex.MatchString(line) {
+				continue
+			}
+			lines = append(lines, line)
+			if eq, err := parseLine(line); err == nil {
+				eqs = append(eqs, eq)
+			}
+		}
+		if len(eqs) == 0 {
+			err = errors.New("no earthquake could be parsed from the page")
+		}
+		if check("parse earthquakes", err) {
+			check("validate earthquakes", validateLines(lines))
+		}
+	}
+
+	if failed {
+		return exitUnknown
+	}
+	return exitOK
+}
+
+func validateLines(lines []string) error {
+	for _, line := range lines {
+		if err := checkColumns(line); err != nil {
+			return fmt.Errorf("%s, line=%s", err, line)
+		}
+		eq, err := parseLine(line)
+		if err != nil {
+			continue
+		}
+		if err := checkCoordinates(eq); err != nil {
+			return fmt.Errorf("%s, line=%s", err, line)
+		}
+	}
+	return nil
+}
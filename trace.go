@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"os"
+	"time"
+)
+
+// traceBodyLimit is how much of a response body is printed by -trace.
+const traceBodyLimit = 1024
+
+// tracingTransport prints requests, responses and their timings to stderr for
+// -trace.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	masked := req.Clone(req.Context())
+	if masked.Header.Get("Authorization") != "" {
+		masked.Header.Set("Authorization", "***")
+	}
+	if dump, err := httputil.DumpRequestOut(masked, false); err == nil {
+		fmt.Fprintf(os.Stderr, "> %s\n", bytes.TrimSpace(dump))
+	}
+	// The trace is added after dumping, which does a round trip of its own.
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timingTrace(start)))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "< error: %s\n", err)
+		return nil, err
+	}
+	if dump, err := httputil.DumpResponse(resp, false); err == nil {
+		fmt.Fprintf(os.Stderr, "< %s\n", bytes.TrimSpace(dump))
+	}
+	head := make([]byte, traceBodyLimit)
+	n, _ := io.ReadFull(resp.Body, head)
+	fmt.Fprintf(os.Stderr, "< %s\n", head[:n])
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head[:n]), resp.Body), totalTimer{start: start, next: resp.Body}}
+	return resp, nil
+}
+
+// timingTrace prints the durations of the connection phases and when the
+// first response byte arrived, to tell slow DNS, network and servers apart.
+func timingTrace(start time.Time) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart time.Time
+	took := func(phase string, phaseStart time.Time) {
+		fmt.Fprintf(os.Stderr, "< %s took %s\n", phase, time.Since(phaseStart).Round(time.Millisecond))
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { took("dns", dnsStart) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { took("connect", connectStart) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { took("tls", tlsStart) },
+		GotFirstResponseByte: func() {
+			fmt.Fprintf(os.Stderr, "< first byte after %s\n", time.Since(start).Round(time.Millisecond))
+		},
+	}
+}
+
+// totalTimer prints how long the request took once its body is closed.
+type totalTimer struct {
+	start time.Time
+	next  io.Closer
+}
+
+func (t totalTimer) Close() error {
+	fmt.Fprintf(os.Stderr, "< total %s\n", time.Since(t.start).Round(time.Millisecond))
+	return t.next.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<pre>earthquakes</pre>")
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: tracingTransport{next: &http.Transport{}}}
+	var body []byte
+	stderr := captureStderr(t, func() {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	})
+	if string(body) != "<pre>earthquakes</pre>" {
+		t.Errorf("body = %q, want it intact after tracing", body)
+	}
+	for _, want := range []string{
+		"> GET / HTTP/1.1",
+		"Authorization: ***",
+		"< HTTP/1.1 200 OK",
+		"< <pre>earthquakes</pre>",
+		"< connect took ",
+		"< first byte after ",
+		"< total ",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("trace does not contain %q:\n%s", want, stderr)
+		}
+	}
+	if strings.Contains(stderr, "secret") {
+		t.Errorf("trace leaks the Authorization header:\n%s", stderr)
+	}
+}
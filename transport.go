@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// newHTTPClient builds the client of every request from the config.
+func newHTTPClient(cfg Config) *http.Client {
+	// The outermost transport sees the request first, so headers wrap the
+	// tracing to have them traced.
+	transport := http.DefaultTransport
+	if cfg.Insecure {
+		fmt.Fprintln(
+			os.Stderr,
+			"warning: TLS certificates are not verified because of -insecure, responses may be forged",
+		)
+		insecure := http.DefaultTransport.(*http.Transport).Clone()
+		insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		transport = insecure
+	}
+	if cfg.Trace {
+		transport = tracingTransport{next: transport}
+	}
+	if len(cfg.Headers) > 0 {
+		transport = headerTransport{headers: cfg.Headers, next: transport}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// headerTransport adds extra headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// parseHeaders parses Name:Value pairs into a map, checking that the names are
+// tokens as RFC 7230 requires.
+func parseHeaders(values []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, value := range values {
+		name, val, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !isToken(name) {
+			return nil, fmt.Errorf("invalid header %q, expected Name:Value", value)
+		}
+		headers[name] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		isAlphaNum := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !isAlphaNum && !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHTTPClientInsecure(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// The server logs the handshake the verifying client rejects.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	if resp, err := newHTTPClient(Config{}).Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Error("default client Get() error = nil, want a certificate error")
+	}
+	resp, err := newHTTPClient(Config{Insecure: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("insecure client Get() error = %v", err)
+	}
+	resp.Body.Close()
+}
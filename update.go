@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	releasesURL        = "https://api.github.com/repos/nacro90/dprm/releases/latest"
+	updateCheckTimeout = 10 * time.Second
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// updateCheck prints whether a newer release than the running version exists.
+// It returns the exit code.
+func updateCheck() int {
+	if os.Getenv("DPRM_NO_UPDATE_CHECK") == "1" {
+		return exitOK
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+	defer cancel()
+	latest, err := getLatestRelease(ctx, releasesURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCode(err)
+	}
+	fmt.Println(updateMessage(latest))
+	return exitOK
+}
+
+func updateMessage(latest string) string {
+	if compareVersions(latest, version) > 0 {
+		return fmt.Sprintf(
+			"Update available: %s (current: %s) — run: go install github.com/nacro90/dprm@latest",
+			latest,
+			version,
+		)
+	}
+	return fmt.Sprintf("Up to date (%s)", version)
+}
+
+func getLatestRelease(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error while creating release request, url=%s: %w", url, err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error while getting latest release, url=%s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", &httpStatusError{Server: "github", URL: url, StatusCode: resp.StatusCode}
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("error while decoding latest release, url=%s: %w", url, err)
+	}
+	return release.TagName, nil
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions numerically. Parts
+// that are missing or not numbers, like in dev builds, count as zero.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if d := versionPart(as, i) - versionPart(bs, i); d != 0 {
+			if d > 0 {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	n, _ := strconv.Atoi(parts[i])
+	return n
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"1.2.3", "v1.2.3", 0},
+		{"v1.2", "v1.2.0", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.2", "v1.2.1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestGetLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept"); got != "application/vnd.github+json" {
+			t.Errorf("Accept = %q, want the GitHub media type", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url":"https://api.github.com/repos/nacro90/dprm/releases/1","tag_name":"v1.4.0","name":"v1.4.0","draft":false,"prerelease":false}`))
+	}))
+	defer server.Close()
+	latest, err := getLatestRelease(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != "v1.4.0" {
+		t.Errorf("getLatestRelease() = %q, want v1.4.0", latest)
+	}
+}
+
+func TestGetLatestReleaseTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := getLatestRelease(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("getLatestRelease() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}